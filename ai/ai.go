@@ -2,84 +2,41 @@ package ai
 
 import (
 	"awesomeProject/db"
+	"awesomeProject/money"
 	"context"
 	"encoding/json"
 	"fmt"
-	"log/slog"
+	"iter"
+	"maps"
+	"slices"
 	"strings"
 
-	"github.com/google/generative-ai-go/genai"
 	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
-	"google.golang.org/api/option"
 
 	"log"
-	"os"
 )
 
+// AI is a Model on top of a Provider. The prompts and the handling of the replies live here,
+// so every provider is asked the same way.
 type AI struct {
-	*genai.Client
+	Provider
+	// Timezone is the IANA name of the user's timezone, used for date ranges in generated queries.
+	Timezone string
 }
 
-func New() *AI {
-	apiKey := os.Getenv("GEMINI_API_KEY")
-
-	ctx := context.Background()
-	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
-	if err != nil {
-		slog.Error("failed to create ai client", "error", err.Error())
-		return nil
-	}
-
-	return &AI{
-		client,
-	}
-}
-
-func (ai AI) PredictCategory(s string) (string, error) {
-	prompt := `You are a financial expert who is very proficient in your job. Right now you're tasked with the responsibility of analysing a transaction and deciding 
+// categoryPromptTemplate tells the model how to categorize a transaction. {{profile}}, {{categories}} and
+// {{corrections}} are replaced with what's known about the user, the stored categories and the user's
+// recent corrections, see CategoryContext.
+const categoryPromptTemplate = `You are a financial expert who is very proficient in your job. Right now you're tasked with the responsibility of analysing a transaction and deciding 
 the category of the transaction. If you fail at your task, you'd be sacked and you'd starve. So you need to think critically before answering.
 
-<RelevantContext>
-The user's name is X X, he is based in Lagos, Nigeria.
-His girlfriend's name is X X.
-These are the names of his family members
- - X X
- - X X
- - X X
- - X X
-
-The following people are food vendors
- - X X
- - X X
- - X X
- - X X
- - X X
-</RelevantContext>
+{{profile}}
 
 It's your job to take a look at the details of the transaction, the date, the party, amount, description
 to ascertain the category in category to which the transaction belongs.
 
 These are the expected transactions
-1. Family
-2. Girlfriend
-3. Food
-4. Internet/Airtime
-5. Clothing
-6. Debt
-7. Cowrywise In
-8. Cowrywise Out
-9. Electricity Bill
-10. Miscellaneous
-11. Church
-12. Transportation
-13. Personal Care
-14. Subscriptions
-15. Drinks
-16. LoanPayment-Out (for when it's a loan-related transaction and I'm the debtor. It has a to be a debit transaction)
-17. LoanPayment-In (for when it's a loan-related transaction and I'm the creditor. It has to be a credit transaction)
-18. LoanRepayment-Out (for when I repay a loan and I'm the debtor. It has to be a debit transaction)
-19. LoanRepayment-In (for when I receive payment for a loan and I'm the creditor. It has to be a credit transaction)
-20. Salary
+{{categories}}
 
 Note, your preference should be to check who the money was sent to or who the money is from.
 Then, the decipher the category from the transaction description.
@@ -87,115 +44,111 @@ Also, use the type of the transaction (CREDIT to indicate that the money is comi
 If you cannot ascertain the category from each, return "UNKNOWN".
 
 <RelevantExamples>
-<Example>
-	<Transaction>	
-		DEBIT; Amount: 5000; Party: Michael  Arowolo/8095609306/Opay Digital Services Limited amount; Description: clothes
-	</Transaction>
-	<ExpectedResponse>
-		Clothing
-	</ExpectedResponse>
-	<Why>
-		From the description, it shows that this is for clothes
-	</Why>
-</Example>
+The names, account numbers and category descriptions in these examples are made up. Always answer with a category from
+the list above, and only rely on what the list and the information about the user actually say.
 <Example>
 	<Transaction>
-		DEBIT Date: 10/5/2024; Amount: 600; Party: ""; Description: 2.5gb for 2 days purchase    
+		DEBIT; Date: 2025-01-01 10:15:00 +0100 WAT; Amount: 5000.00; Party: John Doe/0123456789/Opay Digital Services Limited; Description: clothes
 	</Transaction>
 	<ExpectedResponse>
-		Internet & Airtime
+		the category for clothing, if the list has one
 	</ExpectedResponse>
 	<Why>
-		From the description, you can clearly see the purchase of 2.5gb data for 2 days
+		The description says the money was for clothes
 	</Why>
 </Example>
-
 <Example>
 	<Transaction>
-		DEBIT; Date: 10/5/2024; Amount: 2000; Party: Joy Elu Odama/9118297388/Paycom(Opay); Description: hellll
+		DEBIT; Date: 2025-01-02 08:00:00 +0100 WAT; Amount: 600.00; Party: ""; Description: 2.5gb for 2 days purchase
 	</Transaction>
 	<ExpectedResponse>
-		Feeding
+		the category for mobile data or airtime, if the list has one
 	</ExpectedResponse>
 	<Why>
-		From the provided context, Joy Elu Odama is a food vendor. Since this is a debit transaction, 
-		it's most likely a food purchase.
+		The description is a purchase of 2.5GB of data for 2 days
 	</Why>
 </Example>
 <Example>
 	<Transaction>
-		DEBIT: Date: 2025-01-01 17:35:11 +0000 UTC; Amount: 3000.00; Party: Jeremiah Osaigbokan Lena/2123379333/United Bank For Africa; Description: stuff
+		DEBIT; Date: 2025-01-03 13:00:00 +0100 WAT; Amount: 2000.00; Party: Jane Doe/0123456789/Paycom(Opay); Description: hellll
 	</Transaction>
 	<ExpectedResponse>
-		Unknown
+		the category the information about the user gives Jane Doe, or UNKNOWN if it doesn't mention her
 	</ExpectedResponse>
 	<Why>
-		This is clearly an outward transfer, with a very vague description, so the category should be unknown
+		The description says nothing, so the only clue is who the money went to. If the user has said who Jane Doe is,
+		for example a food vendor, use the category that goes with that. Otherwise there's nothing to go on.
 	</Why>
 </Example>
 <Example>
 	<Transaction>
-		CREDIT: Date: 2025-01-02 18:57:05 +0000 UTC; Amount: 5000.00; Party: Damilola Victoria Odeogberin/7048478064/Paycom(Opay); Description: thanks for coming through babeeeee (loan return)
+		DEBIT; Date: 2025-01-01 17:35:11 +0100 WAT; Amount: 3000.00; Party: John Doe/0123456789/United Bank For Africa; Description: stuff
 	</Transaction>
 	<ExpectedResponse>
-		LoanRepayment-Crdt
+		UNKNOWN
 	</ExpectedResponse>
 	<Why>
-		This is a Credit transaction. Indicating that this is payment for a loan for which I'm the creditor.
+		This is an outward transfer to someone the user hasn't described, with a very vague description
 	</Why>
 </Example>
 <Example>
 	<Transaction>
-		DEBIT: Date: 2025-01-03 13:07:19 +0000 UTC; Amount: 2100.00; Party: Hopeful Okere Uchechi International Business Ventures - Hope Business Ventures1/8203189697/Moniepoint Mfb; Description: charger
+		CREDIT; Date: 2025-01-02 18:57:05 +0100 WAT; Amount: 5000.00; Party: Jane Doe/0123456789/Paycom(Opay); Description: thanks for coming through (loan return)
 	</Transaction>
 	<ExpectedResponse>
-		Miscellaneous
+		the category for loan repayments the user receives, if the list has one
 	</ExpectedResponse>
 	<Why>
-		This is a debit transaction. and the purchase is a charger, which is not vague. this should be marked as Miscellaneous
+		This is a credit, and the description says it's a loan being paid back, so the user is the creditor
 	</Why>
 </Example>
 <Example>
 	<Transaction>
-		DEBIT: Date: 2025-01-23 17:24:25 +0000 UTC; Amount: 2010.00; Party: Pos Transfer-Fatimoh Gbolahan Mudasiru/5877941385/Moniepoint Mfb; Description: beans and eggs
+		DEBIT; Date: 2025-01-23 17:24:25 +0100 WAT; Amount: 2010.00; Party: Pos Transfer-John Doe/0123456789/Moniepoint Mfb; Description: beans and eggs
 	</Transaction>
 	<ExpectedResponse>
-		Feeding
+		the category for food, if the list has one
 	</ExpectedResponse>
 	<Why>
-		Although we don't know who Fatimoh Gbolahan Mudashiru is, we know that bread and eggs are food stuffs
+		Although we don't know who John Doe is, beans and eggs are food
 	</Why>
 </Example>
 </RelevantExamples>
+{{corrections}}
 
 <Important>
-1. It's very important your response is a valid category (provided above).
-2. It's very important your response is a single word (the category).
+1. It's very important your response is a valid category (provided above), spelled exactly as it is in the list, or "UNKNOWN".
+2. It's very important to be honest about how sure you are. A vague transaction should get a low confidence, or "UNKNOWN", rather than a confident guess.
 </Important>`
-	model := ai.GenerativeModel("gemini-2.0-pro-exp")
-	cs := model.StartChat()
-	cs.History = []*genai.Content{
-		{
-			Parts: []genai.Part{
-				genai.Text(prompt),
-			},
-			Role: "user",
-		},
-	}
 
-	res, err := cs.SendMessage(context.Background(), genai.Text(s))
+// PredictCategory categorizes a single transaction, along with how confident the model is and why.
+func (ai *AI) PredictCategory(cc CategoryContext, s string) (CategoryPrediction, error) {
+	text, err := ai.Generate(context.Background(), Conversation{
+		Messages: []Message{
+			{Role: RoleUser, Content: cc.prompt() + singleCategoryPrompt},
+			{Role: RoleUser, Content: s},
+		},
+		Schema: categorySchema,
+	})
 	if err != nil {
-		return "", fmt.Errorf("error getting chat completion: %v", err)
+		return CategoryPrediction{}, err
 	}
 
-	category, ok := res.Candidates[0].Content.Parts[0].(genai.Text)
-	if !ok {
-		return "UNKNOWN", nil
+	var prediction CategoryPrediction
+	if err := json.Unmarshal([]byte(text), &prediction); err != nil {
+		return CategoryPrediction{}, fmt.Errorf("error decoding response: %v", err)
 	}
-	return strings.TrimSpace(string(category)), nil
+	prediction.Category = strings.TrimSpace(prediction.Category)
+	prediction.Confidence = min(max(prediction.Confidence, 0), 1)
+	if prediction.Category == "" {
+		prediction.Category, prediction.Confidence = "UNKNOWN", 0
+	}
+	return prediction, nil
 }
 
-func (ai *AI) GenerateCypher(query string) (string, error) {
+// GenerateCypher writes a query answering the user's question, describing the categories to the model
+// as they're currently stored.
+func (ai *AI) GenerateCypher(categories []Category, query string) (string, error) {
 	prompt := `
 	You're a expect cypher query generator. You're extremely proficient at your job. 
 	Your job is to take a user's query and generate cypher queries that'd return results
@@ -206,38 +159,45 @@ func (ai *AI) GenerateCypher(query string) (string, error) {
 	<DatabaseVisualization>
 
 	Node: Transaction
-		- amount: Double
-		- balance: Double
+		- amount: Integer (in the minor unit of the currency, e.g. kobo: 100 kobo = 1 naira)
+		- balance: Integer (in the minor unit of the currency)
+		- currency: String (ISO 4217 code, e.g. NGN, USD, GBP)
 		- dateTime: DateTime
 		- description: String
 		- party: String
 		- type: String (Credit or Debit)
+		- reversed: Boolean (true for a failed or fully refunded debit and the reversal or refund credit that paid it back)
+		- rawCategory: String (only set on transactions in the UNKNOWN category, the answer that couldn't be matched to a category)
+		- confidence: Float (how sure the categorizer was of the category, from 0 to 1)
+		- reason: String (why the categorizer chose the category)
+		- reviewedAt: DateTime (set once the user has accepted or changed the category)
 	
 	Node: Category
 		- name: String
+
+	Node: Counterparty (the person or business on the other side of a transaction)
+		- name: String
+		- accountNumber: String
+		- bank: String
 	
+	Node: Statement (an uploaded bank statement)
+		- accountNumber: String
+		- periodStart: DateTime
+		- periodEnd: DateTime
+		- openingBalance: Integer (in the minor unit of the currency)
+		- closingBalance: Integer (in the minor unit of the currency)
+
 	Relationships:
 		- BELONGS_TO (Transaction) -> (Category)
+		- CHILD_OF (Category) -> (Category) (from a category to the category it's grouped under)
+		- FROM_STATEMENT (Transaction) -> (Statement)
+		- FEE_FOR (Transaction) -> (Transaction) (from a Bank Charges transaction to the transfer it was charged for)
+		- REVERSED_BY (Transaction) -> (Transaction) (from a failed debit to the credit that reversed it)
+		- SENT_TO (Transaction) -> (Counterparty) (for Debit transactions)
+		- RECEIVED_FROM (Transaction) -> (Counterparty) (for Credit transactions)
 
 	Categories:
-		- Family
-		- Girlfriend
-		- Food
-		- Internet/Airtime
-		- Clothing
-		- Debt
-		- Electricity Bill
-		- Miscellaneous
-		- Church
-		- Transportation
-		- Personal Care
-		- Subscriptions
-		- Drinks
-		- LoanPayment-Out
-		- LoanPayment-In
-		- LoanRepayment-Out
-		- LoanRepayment-In
-		- Salary
+{{categories}}
 
 	</DatabaseVisualization>
 
@@ -256,51 +216,54 @@ func (ai *AI) GenerateCypher(query string) (string, error) {
 	</Important>
 
 	<Examples>
+	The examples below use categories from the list above. In each, suppose today is in the month the explanation gives.
+
 	1. 
 	<Query>
-	How much have I spent on food this month?
+	How much have I spent on {{category}} this month?
 	</Query>
 
 	<Expected Response>
-	MATCH (t:Transaction)-[:BELONGS_TO]->(c:Category {name: "Food"}) WHERE t.dateTime >= datetime("2025-01-01") AND t.dateTime <= datetime("2025-01-31") RETURN t
+	MATCH (t:Transaction)-[:BELONGS_TO]->(c:Category {name: "{{category}}"}) WHERE t.dateTime >= datetime("2025-01-01T00:00:00[{{timezone}}]") AND t.dateTime <= datetime("2025-01-31T23:59:59[{{timezone}}]") AND t.type = "Debit" RETURN t
 	</Expected Response>
 
 	<Explanation>
-	Since the user is asking for how much they've spent on food this month, you need to know which month it currently is.
-	It's February. So you need to get all transactions that belong to the category "Food" and that happened between the first and last day of the month.
+	Since the user is asking how much they've spent on {{category}} this month, you need to know which month it currently is.
+	Suppose it's January 2025. So you need to get all debits that belong to the category "{{category}}" and that happened between the first and last day of the month.
 
 	Note: You should use the datetime() function because the dateTime property is a DateTime type.
 	It's very important to use the correct function for the correct data type.
+	Always give datetimes the user's timezone ({{timezone}}) as shown, otherwise late-night transactions fall on the wrong day.
 	</Explanation>
 
 
 	2. 
 	<Query>
-	Did I pay for electricity last month? How much did I pay?
+	Did I pay anything for {{otherCategory}} last month? How much did I pay?
 	</Query>
 	<ExpectedResponse>
-	MATCH (t:Transaction)-[:BELONGS_TO]->(c:Category {name: "Electricity Bill"}) WHERE t.dateTime >= datetime("2025-01-01") AND t.dateTime <= datetime("2025-01-31") RETURN t
+	MATCH (t:Transaction)-[:BELONGS_TO]->(c:Category {name: "{{otherCategory}}"}) WHERE t.dateTime >= datetime("2025-01-01T00:00:00[{{timezone}}]") AND t.dateTime <= datetime("2025-01-31T23:59:59[{{timezone}}]") AND t.type = "Debit" RETURN t
 	</ExpectedResponse>
 	<Explanation>
-	- The user is asking if they paid for electricity last month and how much they paid.
-	- You need to know which month they're asking for. Since, we're in february, the user is asking for January.
-	- So you should check if there are any transactions that belong to the category "Electricity Bill" that happened in January.
+	- The user is asking if they paid for {{otherCategory}} last month and how much they paid.
+	- You need to know which month they're asking for. Suppose it's February 2025, so the user is asking about January.
+	- So you should check if there are any debits that belong to the category "{{otherCategory}}" that happened in January.
 	- If there are, you should return all the transactions. 
 	</Explanation>
 
 
 	3. 
 	<Query>
-	How much has my girlfriend sent to me this month?
+	How much have I received under {{otherCategory}} this month?
 	</Query>
 	<ExpectedResponse>
-	MATCH (t:Transaction)-[:BELONGS_TO]->(c:Category {name: "Girlfriend"}) WHERE t.dateTime >= datetime("2025-01-01") AND t.dateTime <= datetime("2025-01-31") AND t.type = "Credit" RETURN t
+	MATCH (t:Transaction)-[:BELONGS_TO]->(c:Category {name: "{{otherCategory}}"}) WHERE t.dateTime >= datetime("2025-01-01T00:00:00[{{timezone}}]") AND t.dateTime <= datetime("2025-01-31T23:59:59[{{timezone}}]") AND t.type = "Credit" RETURN t
 	</ExpectedResponse>
 	<Explanation>
-	- The user is asking how much their girlfriend has sent to them this month.
-	- You need to know which month they're asking for. Since, we're in february, the user is asking for January.
+	- The user is asking how much came into their account under {{otherCategory}} this month.
+	- You need to know which month they're asking for. Suppose it's January 2025.
 	- So you should check if there are any transactions that belong
-	to the category "Girlfriend" that happened in January.
+	to the category "{{otherCategory}}" that happened in January.
 	- You should also check if the transaction type is "Credit" because the user is asking for how much was sent to them.
 	- If there are, you should return the transactions.
 	</Explanation>
@@ -308,16 +271,16 @@ func (ai *AI) GenerateCypher(query string) (string, error) {
 
 	4. 
 	<Query>
-	How much have I sent to my girlfriend this month?
+	How much have I sent under {{otherCategory}} this month?
 	</Query>
 	<ExpectedResponse>
-	MATCH (t:Transaction)-[:BELONGS_TO]->(c:Category {name: "Girlfriend"}) WHERE t.dateTime >= datetime("2025-01-01") AND t.dateTime <= datetime("2025-01-31") AND t.type = "Debit" RETURN t
+	MATCH (t:Transaction)-[:BELONGS_TO]->(c:Category {name: "{{otherCategory}}"}) WHERE t.dateTime >= datetime("2025-01-01T00:00:00[{{timezone}}]") AND t.dateTime <= datetime("2025-01-31T23:59:59[{{timezone}}]") AND t.type = "Debit" RETURN t
 	</ExpectedResponse>
 	<Explanation>
-	- The user is asking how much they sent their girlfriend this month.
-	- You need to know which month they're asking for. Since, we're in february, the user is asking for January.
+	- The user is asking how much left their account under {{otherCategory}} this month.
+	- You need to know which month they're asking for. Suppose it's January 2025.
 	- So you should check if there are any transactions that belong
-	to the category "Girlfriend" that happened in January.
+	to the category "{{otherCategory}}" that happened in January.
 	- You should also check if the transaction type is "Debit" because the user is asking for how much they sent.
 	- If there are, you should return the transactions.
 	</Explanation>
@@ -327,12 +290,13 @@ func (ai *AI) GenerateCypher(query string) (string, error) {
 	as at the 19 of last month, how much had i spent? compare that to how much i've spent this month
 	</Query>
 	<ExpectedResponse>
-	MATCH (t:Transaction)-[:BELONGS_TO]->(c:Category) WHERE t.dateTime >= datetime("2025-01-01") AND t.dateTime <= datetime("2025-01-19") AND t.type = "Debit"
-	MATCH (t2:Transaction)-[:BELONGS_TO]->(c:Category) WHERE t2.dateTime >= datetime("2025-02-01") AND t2.dateTime <= datetime("2025-02-19") AND t2.type = "Debit"
+	MATCH (t:Transaction)-[:BELONGS_TO]->(c:Category) WHERE t.dateTime >= datetime("2025-01-01T00:00:00[{{timezone}}]") AND t.dateTime <= datetime("2025-01-19T23:59:59[{{timezone}}]") AND t.type = "Debit"
+	MATCH (t2:Transaction)-[:BELONGS_TO]->(c:Category) WHERE t2.dateTime >= datetime("2025-02-01T00:00:00[{{timezone}}]") AND t2.dateTime <= datetime("2025-02-19T23:59:59[{{timezone}}]") AND t2.type = "Debit"
 	RETURN t, t2
 	</ExpectedResponse>
 	<Explanation>
 	The user is asking for a comparison between the amount spent as at the 19th of last month and the amount spent as at the 19th of this month.
+	Suppose it's February 2025.
 	You need to get all transactions that happened between the 1st and 19th of last month and all transactions that happened between the 1st and 19th of this month.
 	You should return both sets of transactions.
 	</Explanation>
@@ -342,13 +306,33 @@ func (ai *AI) GenerateCypher(query string) (string, error) {
 	you can also create queries by searching fields like description, party, amount, etc.
 	MATCH (t:Transaction) WHERE t.description CONTAINS 'rent' RETURN t
 	MATCH (t:Transaction) WHERE t.party CONTAINS 'john doe' RETURN t
-	MATCH (t:Transaction) WHERE t.amount > 5000 RETURN t
+	MATCH (t:Transaction) WHERE t.amount > 500000 RETURN t
+	amounts are stored in kobo, so always multiply naira amounts from the user's query by 100 before comparing them.
+	amounts in different currencies must never be added together. if the user mentions a currency, filter on it, eg
+	MATCH (t:Transaction) WHERE t.currency = "USD" AND t.type = "Debit" RETURN t
+	if they don't, assume naira (t.currency = "NGN") unless the query is about all their accounts.
 	if the user query is asking for a specific date or dates, you should ensure that the date is correct and valid. considering leap years and the number of days in each month.
 	if the user is asking for a particular person's name, ensure that you convert the search name to lower case in order for it to match any form of the name string, eg
 	MATCH (t:Transaction)
 	WHERE toLower(t.party) CONTAINS toLower("user's name") AND t.type = "Credit"
 	RETURN t
 
+	reversed transactions never really left or entered the account, so leave them out of anything about spending or income
+	by adding coalesce(t.reversed, false) = false to the WHERE clause, unless the user asks about reversals or refunds, eg
+	MATCH (t:Transaction) WHERE t.type = "Debit" AND coalesce(t.reversed, false) = false RETURN t
+	MATCH (t:Transaction)-[:REVERSED_BY]->(r:Transaction) RETURN t, r
+
+	categories can be grouped under a parent category. transactions belong to the specific category, so questions about a group
+	should follow CHILD_OF to include every category under it, eg
+	MATCH (t:Transaction)-[:BELONGS_TO]->(c:Category)-[:CHILD_OF*0..]->(:Category {name: "{{group}}"}) RETURN t
+
+	questions about bank charges, fees, levies or VAT are answered with the Bank Charges category, eg
+	MATCH (t:Transaction)-[:BELONGS_TO]->(c:Category {name: "Bank Charges"}) RETURN t
+
+	questions about who the user paid or got money from are best answered through the Counterparty nodes, eg
+	MATCH (t:Transaction)-[:SENT_TO]->(p:Counterparty) WHERE toLower(p.bank) CONTAINS "opay" RETURN t, p
+	MATCH (t:Transaction)-[:RECEIVED_FROM]->(p:Counterparty) WHERE toLower(p.name) CONTAINS toLower("user's name") RETURN t, p
+
 	if the user's query is unrelated to transactions or their account details. you should return:
 	match (c:Category{name:"empty"})
 	return c
@@ -358,39 +342,31 @@ func (ai *AI) GenerateCypher(query string) (string, error) {
 	YOU'D BE PENALIZED IF YOU DO ANYTHING OTHER THAN THIS.
 	</Important>
 	`
-	model := ai.GenerativeModel("gemini-2.0-pro-exp")
-	cs := model.StartChat()
-	cs.History = []*genai.Content{
-		{
-			Parts: []genai.Part{
-				genai.Text(prompt),
-			},
-			Role: "user",
+	category, otherCategory, group := exampleCategories(categories)
+	prompt = strings.NewReplacer(
+		"{{timezone}}", ai.Timezone,
+		"{{categories}}", renderCategoryTree(categories),
+		"{{category}}", category,
+		"{{otherCategory}}", otherCategory,
+		"{{group}}", group,
+	).Replace(prompt)
+
+	cypher, err := ai.Generate(context.Background(), Conversation{
+		Messages: []Message{
+			{Role: RoleUser, Content: prompt},
+			{Role: RoleUser, Content: query},
 		},
-	}
-
-	res, err := cs.SendMessage(context.Background(), genai.Text(query))
+	})
 	if err != nil {
-		return "", fmt.Errorf("error getting chat completion: %v", err)
-	}
-
-	cypher, ok := res.Candidates[0].Content.Parts[0].(genai.Text)
-	if !ok {
-		return "UNKNOWN", nil
+		return "", err
 	}
 
-	withoutCypherPretext := strings.TrimSuffix(strings.TrimPrefix(string(cypher), "```cypher"), "```")
-	println(withoutCypherPretext)
+	withoutCypherPretext := strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(cypher), "```cypher"), "```")
 	return strings.TrimSpace(withoutCypherPretext), nil
 }
 
-func (ai *AI) Respond(query string, rec []*neo4j.Record, prevMessages []db.Message, cs *genai.ChatSession) *genai.GenerateContentResponseIterator {
-
-	if len(prevMessages) == 0 {
-		cs.History = []*genai.Content{
-			{
-				Parts: []genai.Part{
-					genai.Text(`
+// respondPrompt tells the model how to answer the user from the records their question's query returned.
+const respondPrompt = `
 					your job is to answer the user's query. 
 					you'll be provided the context from which to answer these questions. 
 					respond to the user's query as accurately as you posisbly can using the provided information. 
@@ -398,37 +374,96 @@ func (ai *AI) Respond(query string, rec []*neo4j.Record, prevMessages []db.Messa
 					ensure that you critically analyse each transaction and provide the most accurate response possible.
 					ensure that you do not hallucinate. carefully perform math operations when required. and use the calculator when necessary.
 	
-					You should sound as free and human as possible, not like a robot. default currency is in naira. dates should be described properly
-				`),
-				},
-				Role: "user",
-			},
-		}
-	} else {
-		history := make([]*genai.Content, 0)
-		for _, message := range prevMessages {
-			history = append(history, &genai.Content{
-				Parts: []genai.Part{
-					genai.Text(message.Content),
-				},
-				Role: string(message.Role),
-			})
-		}
-		cs.History = history
+					You should sound as free and human as possible, not like a robot. default currency is in naira, but each transaction
+					has its own currency; never add up amounts in different currencies, report a total per currency instead. dates should be described properly
+				`
+
+// columnResults is what one column of a query's records holds: its distinct nodes and their totals.
+type columnResults struct {
+	seen              map[string]bool
+	records           string
+	totalIn, totalOut map[string]money.Money
+}
+
+// Respond answers the user's question from the records its query returned, following on from the
+// earlier messages of the conversation.
+func (ai *AI) Respond(query string, rec []*neo4j.Record, prevMessages []db.Message) iter.Seq2[string, error] {
+	messages := []Message{{Role: RoleUser, Content: respondPrompt}}
+	for _, message := range prevMessages {
+		messages = append(messages, Message{Role: Role(message.Role), Content: message.Content})
 	}
 
-	recordString := ""
+	// a query can return the same node in many records, a product of two matches repeats each side once
+	// per row of the other, so each column is listed and totalled on its own and counts every node once
+	var columns []string
+	results := make(map[string]*columnResults)
 	for _, r := range rec {
-		for _, v := range r.Values {
+		for i, v := range r.Values {
 			value := v.(neo4j.Node)
-			jsonString, err := json.MarshalIndent(value.Props, " ", " ")
+			column := r.Keys[i]
+			result, ok := results[column]
+			if !ok {
+				result = &columnResults{seen: make(map[string]bool), totalIn: make(map[string]money.Money), totalOut: make(map[string]money.Money)}
+				results[column] = result
+				columns = append(columns, column)
+			}
+			if result.seen[value.ElementId] {
+				continue
+			}
+			result.seen[value.ElementId] = true
+
+			props := make(map[string]any, len(value.Props))
+			for k, p := range value.Props {
+				props[k] = p
+			}
+
+			// amounts are stored in minor units, show them to the model in major units
+			currency, _ := props["currency"].(string)
+			reversed, _ := props["reversed"].(bool)
+			amount, isMoney := props["amount"].(int64)
+			if isMoney {
+				props["amount"] = money.Money(amount).String()
+			}
+			// reversed pairs cancel out, so they're left out of the totals
+			if isMoney && !reversed {
+				if props["type"] == "Debit" {
+					result.totalOut[currency] += money.Money(amount)
+				} else {
+					result.totalIn[currency] += money.Money(amount)
+				}
+			}
+			for _, key := range []string{"balance", "openingBalance", "closingBalance"} {
+				if balance, ok := props[key].(int64); ok {
+					props[key] = money.Money(balance).String()
+				}
+			}
+
+			jsonString, err := json.MarshalIndent(props, " ", " ")
 			if err != nil {
 				log.Printf("Error marshalling record: %v", err)
 			}
-			recordString += string(jsonString) + "\n\n"
+			result.records += string(jsonString) + "\n\n"
 		}
 	}
 
+	// the model isn't reliable at adding up long lists of amounts, so give it exact totals,
+	// kept apart per currency
+	recordString := ""
+	for _, column := range columns {
+		result := results[column]
+		if len(columns) > 1 {
+			recordString += fmt.Sprintf("Results for %s:\n\n", column)
+		}
+		recordString += result.records
+		for _, currency := range slices.Sorted(maps.Keys(result.totalIn)) {
+			recordString += fmt.Sprintf("Total money in (%s): %s\n", currency, result.totalIn[currency])
+		}
+		for _, currency := range slices.Sorted(maps.Keys(result.totalOut)) {
+			recordString += fmt.Sprintf("Total money out (%s): %s\n", currency, result.totalOut[currency])
+		}
+		recordString += "\n"
+	}
+
 	query = fmt.Sprintf(
 		`<Query>%s</Query> 
 
@@ -437,10 +472,6 @@ func (ai *AI) Respond(query string, rec []*neo4j.Record, prevMessages []db.Messa
 		recordString,
 	)
 
-	res := cs.SendMessageStream(context.Background(), genai.Text(query))
-	return res
-}
-
-func (ai *AI) Close() error {
-	return ai.Client.Close()
+	messages = append(messages, Message{Role: RoleUser, Content: query})
+	return ai.Stream(context.Background(), Conversation{Messages: messages})
 }
@@ -0,0 +1,58 @@
+package ai
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+func TestRespondTotals(t *testing.T) {
+	transaction := func(id string, amount int64, kind string) neo4j.Node {
+		return neo4j.Node{ElementId: id, Props: map[string]any{"amount": amount, "type": kind, "currency": "NGN"}}
+	}
+	march := []neo4j.Node{transaction("1", 100000, "Debit"), transaction("2", 50000, "Debit")}
+	april := []neo4j.Node{transaction("3", 20000, "Debit"), transaction("4", 300000, "Credit")}
+
+	// MATCH t ... MATCH t2 ... RETURN t, t2 returns every pair
+	var records []*neo4j.Record
+	for _, t := range march {
+		for _, t2 := range april {
+			records = append(records, &neo4j.Record{Keys: []string{"t", "t2"}, Values: []any{t, t2}})
+		}
+	}
+
+	provider := &stubProvider{}
+	ai := &AI{Provider: provider}
+	for range ai.Respond("did I spend more in April than in March?", records, nil) {
+	}
+
+	context := provider.conversations[0].Messages[1].Content
+	for _, want := range []string{
+		"Results for t:", "Total money out (NGN): 1500.00",
+		"Results for t2:", "Total money in (NGN): 3000.00", "Total money out (NGN): 200.00",
+	} {
+		if !strings.Contains(context, want) {
+			t.Errorf("Respond() context is missing %q:\n%s", want, context)
+		}
+	}
+	if n := strings.Count(context, `"amount": "1000.00"`); n != 1 {
+		t.Errorf("Respond() context lists transaction 1 %d times, want once", n)
+	}
+}
+
+func TestRespondStatementBalances(t *testing.T) {
+	statement := neo4j.Node{ElementId: "s", Props: map[string]any{"openingBalance": int64(1250050), "closingBalance": int64(99), "currency": "NGN"}}
+
+	provider := &stubProvider{}
+	ai := &AI{Provider: provider}
+	for range ai.Respond("what was my closing balance?", []*neo4j.Record{{Keys: []string{"s"}, Values: []any{statement}}}, nil) {
+	}
+
+	context := provider.conversations[0].Messages[1].Content
+	for _, want := range []string{`"openingBalance": "12500.50"`, `"closingBalance": "0.99"`} {
+		if !strings.Contains(context, want) {
+			t.Errorf("Respond() context is missing %s:\n%s", want, context)
+		}
+	}
+}
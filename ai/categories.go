@@ -0,0 +1,92 @@
+package ai
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Category is a category transactions can be filed under, as the prompts describe it.
+type Category struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Parent is the name of the category this one is grouped under, if any.
+	Parent string `json:"parent"`
+}
+
+// renderCategoryChoices lists the categories the categorizer may answer with: every category
+// that doesn't have others grouped under it.
+func renderCategoryChoices(categories []Category) string {
+	parents := make(map[string]bool)
+	for _, c := range categories {
+		if c.Parent != "" {
+			parents[c.Parent] = true
+		}
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, c := range categories {
+		if parents[c.Name] {
+			continue
+		}
+		n++
+		fmt.Fprintf(&b, "%d. %s", n, c.Name)
+		if c.Description != "" {
+			fmt.Fprintf(&b, " (%s)", c.Description)
+		}
+		b.WriteString("\n")
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// renderCategoryTree lists every category for the query generator, with the group it's under.
+func renderCategoryTree(categories []Category) string {
+	var b strings.Builder
+	for _, c := range categories {
+		fmt.Fprintf(&b, "\t\t- %s", c.Name)
+		if c.Description != "" {
+			fmt.Fprintf(&b, " (%s)", c.Description)
+		}
+		if c.Parent != "" {
+			fmt.Fprintf(&b, " [under %s]", c.Parent)
+		}
+		b.WriteString("\n")
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// exampleCategories picks the categories the query generator's examples are written with, so they only
+// name categories that exist: two that transactions are filed under, and a group. Without a group, the
+// first category stands in for one, since following CHILD_OF*0.. from it still finds its transactions.
+func exampleCategories(categories []Category) (category, otherCategory, group string) {
+	parents := make(map[string]bool)
+	for _, c := range categories {
+		if c.Parent != "" {
+			parents[c.Parent] = true
+		}
+	}
+
+	var choices []string
+	for _, c := range categories {
+		if parents[c.Name] {
+			if group == "" {
+				group = c.Name
+			}
+			continue
+		}
+		choices = append(choices, c.Name)
+	}
+
+	switch len(choices) {
+	case 0:
+		category, otherCategory = "UNKNOWN", "UNKNOWN"
+	case 1:
+		category, otherCategory = choices[0], choices[0]
+	default:
+		category, otherCategory = choices[0], choices[1]
+	}
+	if group == "" {
+		group = category
+	}
+	return category, otherCategory, group
+}
@@ -0,0 +1,238 @@
+package ai
+
+import (
+	"awesomeProject/db"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// CategoryContext is what the model is told about the user when it categorizes their transactions.
+type CategoryContext struct {
+	Profile    db.Profile
+	Categories []Category
+	// Corrections are categories the user fixed by hand, most recent first. They're shown to the model
+	// as examples so it stops making the same mistakes.
+	Corrections []Correction
+}
+
+// Correction is a transaction the model got wrong, with the category the user moved it to.
+type Correction struct {
+	Transaction string
+	Wrong       string
+	Category    string
+}
+
+// prompt renders the categorizer prompt for this context.
+func (cc CategoryContext) prompt() string {
+	return strings.NewReplacer(
+		"{{profile}}", renderProfile(cc.Profile),
+		"{{categories}}", renderCategoryChoices(cc.Categories),
+		"{{corrections}}", renderCorrections(cc.Corrections),
+	).Replace(categoryPromptTemplate)
+}
+
+// renderCorrections lists the user's corrections as examples. They take precedence over the examples
+// above them, since they're the user's own judgement.
+func renderCorrections(corrections []Correction) string {
+	if len(corrections) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("\n<Corrections>\n")
+	b.WriteString("These transactions were categorized wrongly before and corrected by the user. Categorize similar transactions the same way.\n")
+	for _, c := range corrections {
+		fmt.Fprintf(&b, "<Example>\n\t<Transaction>\n\t\t%s\n\t</Transaction>\n\t<ExpectedResponse>\n\t\t%s\n\t</ExpectedResponse>\n", c.Transaction, c.Category)
+		if c.Wrong != "" {
+			fmt.Fprintf(&b, "\t<Why>\n\t\tThis was categorized as %s, which the user said was wrong\n\t</Why>\n", c.Wrong)
+		}
+		b.WriteString("</Example>\n")
+	}
+	b.WriteString("</Corrections>")
+	return b.String()
+}
+
+// renderProfile describes the user to the model. Relationships and vendors are what let it tell
+// a transfer to a sibling from a payment to a food vendor.
+func renderProfile(p db.Profile) string {
+	var b strings.Builder
+	b.WriteString("<RelevantContext>\n")
+
+	switch {
+	case p.Name != "" && p.Location != "":
+		fmt.Fprintf(&b, "The user's name is %s, and they're based in %s.\n", p.Name, p.Location)
+	case p.Name != "":
+		fmt.Fprintf(&b, "The user's name is %s.\n", p.Name)
+	case p.Location != "":
+		fmt.Fprintf(&b, "The user is based in %s.\n", p.Location)
+	default:
+		b.WriteString("Nothing is known about the user, so go by the transaction alone.\n")
+	}
+
+	if len(p.People) > 0 {
+		b.WriteString("\nThese are people the user knows, and who they are to the user\n")
+		for _, person := range p.People {
+			fmt.Fprintf(&b, " - %s%s%s%s\n", person.Name, parenthesized(person.Relationship), categoryHint(person.Category), notes(person.Notes))
+		}
+	}
+
+	if len(p.Vendors) > 0 {
+		b.WriteString("\nThe following are vendors the user buys from\n")
+		for _, vendor := range p.Vendors {
+			fmt.Fprintf(&b, " - %s%s%s\n", vendor.Name, categoryHint(vendor.Category), notes(vendor.Notes))
+		}
+	}
+
+	b.WriteString("</RelevantContext>")
+	return b.String()
+}
+
+func parenthesized(s string) string {
+	if s == "" {
+		return ""
+	}
+	return " (" + s + ")"
+}
+
+func categoryHint(category string) string {
+	if category == "" {
+		return ""
+	}
+	return ", usually " + category
+}
+
+func notes(s string) string {
+	if s == "" {
+		return ""
+	}
+	return ": " + s
+}
+
+// CategoryRequest is a transaction to categorize as part of a batch.
+type CategoryRequest struct {
+	// ID identifies the transaction within the batch.
+	ID          string `json:"id"`
+	Transaction string `json:"transaction"`
+}
+
+// CategoryPrediction is the model's answer for one transaction of a batch.
+type CategoryPrediction struct {
+	ID       string `json:"id"`
+	Category string `json:"category"`
+	// Confidence is between 0 and 1.
+	Confidence float64 `json:"confidence"`
+	Reason     string  `json:"reason"`
+}
+
+// singleCategoryPrompt is added to the categorizer prompt when a transaction is categorized on its own.
+const singleCategoryPrompt = `
+
+<ResponseInstructions>
+Respond with a JSON object with:
+ - "category": the category, one of the categories above or "UNKNOWN"
+ - "confidence": how sure you are of the category, from 0 to 1
+ - "reason": one short sentence on why
+</ResponseInstructions>`
+
+// categorySchema constrains the model's response to a single transaction.
+var categorySchema = &Schema{
+	Type: "object",
+	Properties: map[string]*Schema{
+		"category":   {Type: "string"},
+		"confidence": {Type: "number"},
+		"reason":     {Type: "string"},
+	},
+	Required: []string{"category", "confidence", "reason"},
+}
+
+// batchCategoryPrompt is added to the categorizer prompt when transactions are categorized in batches.
+const batchCategoryPrompt = `
+
+<BatchInstructions>
+You'll be given a JSON array of transactions, each with an "id" and the "transaction" itself.
+Categorize every one of them on its own, exactly as you would if it were the only transaction.
+Respond with a JSON object whose "predictions" array holds one object per transaction, with:
+ - "id": the id of the transaction, copied exactly
+ - "category": the category, one of the categories above or "UNKNOWN"
+ - "confidence": how sure you are of the category, from 0 to 1
+ - "reason": one short sentence on why
+</BatchInstructions>`
+
+// categoryBatchSchema constrains the model's response to a batch. The answers are wrapped in an object,
+// since OpenAI's strict structured outputs only accept an object at the top level.
+var categoryBatchSchema = &Schema{
+	Type: "object",
+	Properties: map[string]*Schema{
+		"predictions": {
+			Type: "array",
+			Items: &Schema{
+				Type: "object",
+				Properties: map[string]*Schema{
+					"id":         {Type: "string"},
+					"category":   {Type: "string"},
+					"confidence": {Type: "number"},
+					"reason":     {Type: "string"},
+				},
+				Required: []string{"id", "category", "confidence", "reason"},
+			},
+		},
+	},
+	Required: []string{"predictions"},
+}
+
+// categoryBatchResponse is the model's response to a batch.
+type categoryBatchResponse struct {
+	Predictions []CategoryPrediction `json:"predictions"`
+}
+
+// PredictCategories categorizes a batch of transactions in a single request.
+// Answers for ids that weren't asked about, repeated ids and answers without a category are dropped,
+// so the returned map only holds the transactions the model answered properly, keyed by id.
+func (ai *AI) PredictCategories(cc CategoryContext, requests []CategoryRequest) (map[string]CategoryPrediction, error) {
+	batch, err := json.Marshal(requests)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding batch: %v", err)
+	}
+
+	text, err := ai.Generate(context.Background(), Conversation{
+		Messages: []Message{
+			{Role: RoleUser, Content: cc.prompt() + batchCategoryPrompt},
+			{Role: RoleUser, Content: string(batch)},
+		},
+		Schema: categoryBatchSchema,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var response categoryBatchResponse
+	if err := json.Unmarshal([]byte(text), &response); err != nil {
+		return nil, fmt.Errorf("error decoding batch response: %v", err)
+	}
+	answers := response.Predictions
+
+	asked := make(map[string]bool, len(requests))
+	for _, r := range requests {
+		asked[r.ID] = true
+	}
+
+	predictions := make(map[string]CategoryPrediction, len(answers))
+	seen := make(map[string]bool, len(answers))
+	for _, a := range answers {
+		a.Category = strings.TrimSpace(a.Category)
+		a.Confidence = min(max(a.Confidence, 0), 1)
+		if !asked[a.ID] || a.Category == "" {
+			continue
+		}
+		// an id answered twice can't be trusted either way
+		if seen[a.ID] {
+			delete(predictions, a.ID)
+			continue
+		}
+		seen[a.ID] = true
+		predictions[a.ID] = a
+	}
+	return predictions, nil
+}
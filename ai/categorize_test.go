@@ -0,0 +1,109 @@
+package ai
+
+import (
+	"context"
+	"iter"
+	"testing"
+)
+
+// stubProvider answers every request with the same reply, and keeps the conversations it was sent.
+type stubProvider struct {
+	reply         string
+	err           error
+	conversations []Conversation
+}
+
+func (p *stubProvider) Generate(ctx context.Context, conversation Conversation) (string, error) {
+	p.conversations = append(p.conversations, conversation)
+	return p.reply, p.err
+}
+
+func (p *stubProvider) Stream(ctx context.Context, conversation Conversation) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		reply, err := p.Generate(ctx, conversation)
+		yield(reply, err)
+	}
+}
+
+func (p *stubProvider) Close() error {
+	return nil
+}
+
+func TestPredictCategories(t *testing.T) {
+	requests := []CategoryRequest{{ID: "0", Transaction: "a"}, {ID: "1", Transaction: "b"}, {ID: "2", Transaction: "c"}, {ID: "3", Transaction: "d"}}
+
+	tests := []struct {
+		name  string
+		reply string
+		want  map[string]CategoryPrediction
+		err   bool
+	}{
+		{
+			name:  "every id answered",
+			reply: `{"predictions": [{"id": "0", "category": "Food", "confidence": 0.9, "reason": "lunch"}, {"id": "1", "category": " Drinks ", "confidence": 0.5, "reason": "bar"}]}`,
+			want: map[string]CategoryPrediction{
+				"0": {ID: "0", Category: "Food", Confidence: 0.9, Reason: "lunch"},
+				"1": {ID: "1", Category: "Drinks", Confidence: 0.5, Reason: "bar"},
+			},
+		},
+		{
+			name: "ids that weren't asked",
+			reply: `{"predictions": [{"id": "0", "category": "Food", "confidence": 0.9, "reason": ""},
+				{"id": "7", "category": "Food", "confidence": 0.9, "reason": ""}, {"id": "", "category": "Food", "confidence": 0.9, "reason": ""}]}`,
+			want: map[string]CategoryPrediction{"0": {ID: "0", Category: "Food", Confidence: 0.9}},
+		},
+		{
+			name: "duplicate ids",
+			reply: `{"predictions": [{"id": "0", "category": "Food", "confidence": 0.9, "reason": ""}, {"id": "1", "category": "Food", "confidence": 0.9, "reason": ""},
+				{"id": "0", "category": "Drinks", "confidence": 0.9, "reason": ""}, {"id": "0", "category": "Church", "confidence": 0.9, "reason": ""}]}`,
+			want: map[string]CategoryPrediction{"1": {ID: "1", Category: "Food", Confidence: 0.9}},
+		},
+		{
+			name:  "no category and confidence out of range",
+			reply: `{"predictions": [{"id": "0", "category": " ", "confidence": 0.9, "reason": ""}, {"id": "1", "category": "Food", "confidence": 7, "reason": ""}, {"id": "2", "category": "Food", "confidence": -1, "reason": ""}]}`,
+			want: map[string]CategoryPrediction{
+				"1": {ID: "1", Category: "Food", Confidence: 1},
+				"2": {ID: "2", Category: "Food", Confidence: 0},
+			},
+		},
+		{name: "bare array", reply: `[{"id": "0", "category": "Food", "confidence": 0.9, "reason": ""}]`, err: true},
+		{name: "not json", reply: `Food`, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &stubProvider{reply: tt.reply}
+			ai := &AI{Provider: provider}
+
+			got, err := ai.PredictCategories(CategoryContext{}, requests)
+			if (err != nil) != tt.err {
+				t.Fatalf("PredictCategories() error = %v, want error %v", err, tt.err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("PredictCategories() = %v, want %v", got, tt.want)
+			}
+			for id, want := range tt.want {
+				if got[id] != want {
+					t.Errorf("PredictCategories()[%q] = %+v, want %+v", id, got[id], want)
+				}
+			}
+
+			// strict structured outputs only take an object at the top level
+			if schema := provider.conversations[0].Schema; schema == nil || schema.Type != "object" {
+				t.Errorf("batch schema = %+v, want an object", schema)
+			}
+		})
+	}
+}
+
+func TestOpenAISchema(t *testing.T) {
+	schema := openAISchema(categoryBatchSchema)
+	if schema["type"] != "object" || schema["additionalProperties"] != false {
+		t.Fatalf("openAISchema() = %v, want a closed object", schema)
+	}
+	predictions := schema["properties"].(map[string]any)["predictions"].(map[string]any)
+	items := predictions["items"].(map[string]any)
+	if predictions["type"] != "array" || items["type"] != "object" || items["additionalProperties"] != false {
+		t.Errorf("openAISchema() predictions = %v, want an array of closed objects", predictions)
+	}
+}
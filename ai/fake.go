@@ -0,0 +1,115 @@
+package ai
+
+import (
+	"awesomeProject/db"
+	"iter"
+	"strings"
+	"sync"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// Fake is a Model that answers from a script, for tests. It never touches the network and always
+// gives the same answers to the same questions.
+type Fake struct {
+	// Categories are tried in order, the first whose Match is in the transaction decides its category.
+	// Transactions matching none are answered with UNKNOWN.
+	Categories []FakeCategory
+	// Cypher is the query every question is answered with.
+	Cypher string
+	// Response is streamed back by Respond, one chunk at a time.
+	Response []string
+	// Err, when set, is returned by every call instead of an answer. BatchErr is only returned by PredictCategories.
+	Err      error
+	BatchErr error
+
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+// FakeCategory is a scripted answer for the transactions containing Match.
+type FakeCategory struct {
+	Match      string
+	Category   string
+	Confidence float64
+}
+
+var _ Model = (*Fake)(nil)
+
+func (f *Fake) record(method string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.calls == nil {
+		f.calls = make(map[string]int)
+	}
+	f.calls[method]++
+}
+
+// Calls returns how many times a method has been called.
+func (f *Fake) Calls(method string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[method]
+}
+
+func (f *Fake) predict(transaction string) CategoryPrediction {
+	for _, c := range f.Categories {
+		if strings.Contains(transaction, c.Match) {
+			return CategoryPrediction{Category: c.Category, Confidence: c.Confidence, Reason: "matched " + c.Match}
+		}
+	}
+	return CategoryPrediction{Category: "UNKNOWN", Reason: "matched nothing"}
+}
+
+func (f *Fake) PredictCategory(cc CategoryContext, transaction string) (CategoryPrediction, error) {
+	f.record("PredictCategory")
+	if f.Err != nil {
+		return CategoryPrediction{}, f.Err
+	}
+	return f.predict(transaction), nil
+}
+
+func (f *Fake) PredictCategories(cc CategoryContext, requests []CategoryRequest) (map[string]CategoryPrediction, error) {
+	f.record("PredictCategories")
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	if f.BatchErr != nil {
+		return nil, f.BatchErr
+	}
+
+	predictions := make(map[string]CategoryPrediction, len(requests))
+	for _, r := range requests {
+		prediction := f.predict(r.Transaction)
+		prediction.ID = r.ID
+		predictions[r.ID] = prediction
+	}
+	return predictions, nil
+}
+
+func (f *Fake) GenerateCypher(categories []Category, query string) (string, error) {
+	f.record("GenerateCypher")
+	if f.Err != nil {
+		return "", f.Err
+	}
+	return f.Cypher, nil
+}
+
+func (f *Fake) Respond(query string, records []*neo4j.Record, history []db.Message) iter.Seq2[string, error] {
+	f.record("Respond")
+	return func(yield func(string, error) bool) {
+		if f.Err != nil {
+			yield("", f.Err)
+			return
+		}
+		for _, chunk := range f.Response {
+			if !yield(chunk, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (f *Fake) Close() error {
+	return nil
+}
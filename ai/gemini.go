@@ -0,0 +1,133 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+// Gemini is a Provider for Google's Gemini API.
+type Gemini struct {
+	client *genai.Client
+	model  string
+}
+
+// NewGemini creates a Gemini provider for the named model.
+func NewGemini(apiKey, model string) (*Gemini, error) {
+	client, err := genai.NewClient(context.Background(), option.WithAPIKey(apiKey))
+	if err != nil {
+		return nil, err
+	}
+	return &Gemini{client: client, model: model}, nil
+}
+
+// chat starts a chat session with every message of the conversation but the last, which is returned to be sent.
+func (g *Gemini) chat(conversation Conversation) (*genai.ChatSession, genai.Text, error) {
+	if len(conversation.Messages) == 0 {
+		return nil, "", fmt.Errorf("error getting chat completion: empty conversation")
+	}
+
+	model := g.client.GenerativeModel(g.model)
+	if conversation.Schema != nil {
+		model.ResponseMIMEType = "application/json"
+		model.ResponseSchema = geminiSchema(conversation.Schema)
+	}
+
+	cs := model.StartChat()
+	history, last := conversation.Messages[:len(conversation.Messages)-1], conversation.Messages[len(conversation.Messages)-1]
+	for _, m := range history {
+		cs.History = append(cs.History, &genai.Content{Parts: []genai.Part{genai.Text(m.Content)}, Role: string(m.Role)})
+	}
+	return cs, genai.Text(last.Content), nil
+}
+
+func (g *Gemini) Generate(ctx context.Context, conversation Conversation) (string, error) {
+	cs, message, err := g.chat(conversation)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := cs.SendMessage(ctx, message)
+	if err != nil {
+		return "", fmt.Errorf("error getting chat completion: %w", err)
+	}
+	return responseText(res)
+}
+
+func (g *Gemini) Stream(ctx context.Context, conversation Conversation) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		cs, message, err := g.chat(conversation)
+		if err != nil {
+			yield("", err)
+			return
+		}
+
+		res := cs.SendMessageStream(ctx, message)
+		for {
+			chunk, err := res.Next()
+			if errors.Is(err, iterator.Done) {
+				return
+			}
+			if err != nil {
+				yield("", fmt.Errorf("error streaming chat completion: %w", err))
+				return
+			}
+
+			text, err := responseText(chunk)
+			if err != nil {
+				yield("", err)
+				return
+			}
+			if !yield(text, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (g *Gemini) Close() error {
+	return g.client.Close()
+}
+
+// responseText returns the text of the first candidate of a response.
+func responseText(res *genai.GenerateContentResponse) (string, error) {
+	if len(res.Candidates) == 0 || res.Candidates[0].Content == nil || len(res.Candidates[0].Content.Parts) == 0 {
+		return "", fmt.Errorf("error getting chat completion: empty response")
+	}
+
+	text, ok := res.Candidates[0].Content.Parts[0].(genai.Text)
+	if !ok {
+		return "", fmt.Errorf("error getting chat completion: unexpected response part %T", res.Candidates[0].Content.Parts[0])
+	}
+	return string(text), nil
+}
+
+// geminiSchema converts a Schema to Gemini's own schema type.
+func geminiSchema(s *Schema) *genai.Schema {
+	if s == nil {
+		return nil
+	}
+
+	types := map[string]genai.Type{
+		"object":  genai.TypeObject,
+		"array":   genai.TypeArray,
+		"string":  genai.TypeString,
+		"number":  genai.TypeNumber,
+		"integer": genai.TypeInteger,
+		"boolean": genai.TypeBoolean,
+	}
+
+	schema := &genai.Schema{Type: types[s.Type], Items: geminiSchema(s.Items), Required: s.Required}
+	if len(s.Properties) > 0 {
+		schema.Properties = make(map[string]*genai.Schema, len(s.Properties))
+		for name, p := range s.Properties {
+			schema.Properties[name] = geminiSchema(p)
+		}
+	}
+	return schema
+}
@@ -0,0 +1,104 @@
+package ai
+
+import (
+	"awesomeProject/db"
+	"cmp"
+	"context"
+	"iter"
+	"log/slog"
+	"os"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// Model is everything the app asks of a language model. AI implements it on top of any Provider,
+// and Fake implements it from a script for tests.
+type Model interface {
+	// PredictCategory categorizes a single transaction.
+	PredictCategory(cc CategoryContext, transaction string) (CategoryPrediction, error)
+	// PredictCategories categorizes a batch of transactions in a single request.
+	PredictCategories(cc CategoryContext, requests []CategoryRequest) (map[string]CategoryPrediction, error)
+	// GenerateCypher writes a query answering the user's question.
+	GenerateCypher(categories []Category, query string) (string, error)
+	// Respond answers the user's question from the records the query returned, yielding the answer as it's written.
+	Respond(query string, records []*neo4j.Record, history []db.Message) iter.Seq2[string, error]
+	Close() error
+}
+
+// Role is who wrote a message of a conversation.
+type Role string
+
+const (
+	RoleUser  Role = "user"
+	RoleModel Role = "model"
+)
+
+// Message is a single turn of a conversation with a model.
+type Message struct {
+	Role    Role
+	Content string
+}
+
+// Conversation is what's sent to a provider: the messages so far, ending with the one to reply to.
+type Conversation struct {
+	Messages []Message
+	// Schema, when set, constrains the reply to JSON matching it.
+	Schema *Schema
+}
+
+// Schema describes the JSON a reply has to match. It's a subset of JSON Schema that every provider supports.
+type Schema struct {
+	Type       string             `json:"type"`
+	Properties map[string]*Schema `json:"properties,omitempty"`
+	Items      *Schema            `json:"items,omitempty"`
+	Required   []string           `json:"required,omitempty"`
+}
+
+// Provider sends conversations to a model API.
+type Provider interface {
+	// Generate returns the model's reply to the last message of the conversation.
+	Generate(ctx context.Context, conversation Conversation) (string, error)
+	// Stream yields the model's reply as it's generated.
+	Stream(ctx context.Context, conversation Conversation) iter.Seq2[string, error]
+	Close() error
+}
+
+// defaultGeminiModel is the Gemini model used when LLM_MODEL isn't set.
+const defaultGeminiModel = "gemini-2.0-pro-exp"
+
+// New creates the model configured by the environment. LLM_PROVIDER picks the API: "gemini", the default,
+// uses GEMINI_API_KEY, and "openai" uses OPENAI_BASE_URL and OPENAI_API_KEY, which also covers local
+// servers such as Ollama and llama.cpp. LLM_MODEL overrides the model name, and LLM_REQUESTS_PER_MINUTE
+// is the quota requests are spread out to fit.
+// It returns nil if the provider isn't configured, in which case transactions are categorized offline
+// and chat is unavailable.
+func New(timezone string) Model {
+	var provider Provider
+	switch name := os.Getenv("LLM_PROVIDER"); name {
+	case "", "gemini":
+		apiKey := os.Getenv("GEMINI_API_KEY")
+		if apiKey == "" {
+			slog.Warn("GEMINI_API_KEY isn't set, categorizing offline and disabling chat")
+			return nil
+		}
+
+		gemini, err := NewGemini(apiKey, cmp.Or(os.Getenv("LLM_MODEL"), defaultGeminiModel))
+		if err != nil {
+			slog.Error("failed to create ai client", "error", err.Error())
+			return nil
+		}
+		provider = gemini
+	case "openai":
+		model := os.Getenv("LLM_MODEL")
+		if model == "" {
+			slog.Warn("LLM_MODEL isn't set, categorizing offline and disabling chat")
+			return nil
+		}
+		provider = NewOpenAI(cmp.Or(os.Getenv("OPENAI_BASE_URL"), defaultOpenAIBaseURL), os.Getenv("OPENAI_API_KEY"), model)
+	default:
+		slog.Error("unknown LLM_PROVIDER, categorizing offline and disabling chat", "provider", name)
+		return nil
+	}
+
+	return &AI{Provider: withRetries(provider, requestsPerMinute()), Timezone: timezone}
+}
@@ -0,0 +1,182 @@
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"strings"
+)
+
+// defaultOpenAIBaseURL is the API used when OPENAI_BASE_URL isn't set.
+const defaultOpenAIBaseURL = "https://api.openai.com/v1"
+
+// OpenAI is a Provider for the OpenAI chat completions API, and for the servers that copy it,
+// such as Ollama (http://localhost:11434/v1) and llama.cpp's server (http://localhost:8080/v1).
+type OpenAI struct {
+	BaseURL string
+	// APIKey is sent as a bearer token. Local servers usually don't need one.
+	APIKey string
+	Model  string
+	Client *http.Client
+}
+
+// NewOpenAI creates an OpenAI-compatible provider for the named model.
+func NewOpenAI(baseURL, apiKey, model string) *OpenAI {
+	return &OpenAI{BaseURL: strings.TrimSuffix(baseURL, "/"), APIKey: apiKey, Model: model, Client: http.DefaultClient}
+}
+
+type openAIMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type openAIRequest struct {
+	Model          string          `json:"model"`
+	Messages       []openAIMessage `json:"messages"`
+	Stream         bool            `json:"stream,omitempty"`
+	ResponseFormat any             `json:"response_format,omitempty"`
+}
+
+type openAIResponse struct {
+	Choices []struct {
+		Message openAIMessage `json:"message"`
+		// Delta is set instead of Message on streamed chunks
+		Delta openAIMessage `json:"delta"`
+	} `json:"choices"`
+}
+
+// StatusError is returned when a provider answers with an HTTP error status.
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("status %d: %s", e.StatusCode, e.Body)
+}
+
+func (o *OpenAI) request(ctx context.Context, conversation Conversation, stream bool) (*http.Response, error) {
+	body := openAIRequest{Model: o.Model, Stream: stream}
+	for _, m := range conversation.Messages {
+		role := "user"
+		if m.Role == RoleModel {
+			role = "assistant"
+		}
+		body.Messages = append(body.Messages, openAIMessage{Role: role, Content: m.Content})
+	}
+	if conversation.Schema != nil {
+		body.ResponseFormat = map[string]any{
+			"type":        "json_schema",
+			"json_schema": map[string]any{"name": "response", "schema": openAISchema(conversation.Schema), "strict": true},
+		}
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.BaseURL+"/chat/completions", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if o.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.APIKey)
+	}
+
+	res, err := o.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error getting chat completion: %w", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+		return nil, fmt.Errorf("error getting chat completion: %w", &StatusError{StatusCode: res.StatusCode, Body: string(message)})
+	}
+	return res, nil
+}
+
+func (o *OpenAI) Generate(ctx context.Context, conversation Conversation) (string, error) {
+	res, err := o.request(ctx, conversation, false)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	var completion openAIResponse
+	if err := json.NewDecoder(res.Body).Decode(&completion); err != nil {
+		return "", fmt.Errorf("error decoding chat completion: %w", err)
+	}
+	if len(completion.Choices) == 0 {
+		return "", fmt.Errorf("error getting chat completion: empty response")
+	}
+	return completion.Choices[0].Message.Content, nil
+}
+
+// Stream reads the reply from the server-sent events of a streamed completion.
+func (o *OpenAI) Stream(ctx context.Context, conversation Conversation) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		res, err := o.request(ctx, conversation, true)
+		if err != nil {
+			yield("", err)
+			return
+		}
+		defer res.Body.Close()
+
+		scanner := bufio.NewScanner(res.Body)
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data:")
+			if !ok {
+				continue
+			}
+			data = strings.TrimSpace(data)
+			if data == "[DONE]" {
+				return
+			}
+
+			var chunk openAIResponse
+			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+				yield("", fmt.Errorf("error decoding chat completion: %w", err))
+				return
+			}
+			if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+				continue
+			}
+			if !yield(chunk.Choices[0].Delta.Content, nil) {
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			yield("", fmt.Errorf("error streaming chat completion: %w", err))
+		}
+	}
+}
+
+func (o *OpenAI) Close() error {
+	return nil
+}
+
+// openAISchema converts a Schema to JSON Schema as strict structured outputs want it,
+// with no properties beyond the ones listed.
+func openAISchema(s *Schema) map[string]any {
+	schema := map[string]any{"type": s.Type}
+	if s.Items != nil {
+		schema["items"] = openAISchema(s.Items)
+	}
+	if s.Type == "object" {
+		properties := make(map[string]any, len(s.Properties))
+		for name, p := range s.Properties {
+			properties[name] = openAISchema(p)
+		}
+		schema["properties"] = properties
+		schema["required"] = s.Required
+		schema["additionalProperties"] = false
+	}
+	return schema
+}
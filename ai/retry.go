@@ -0,0 +1,228 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+// defaultRequestsPerMinute is the model quota assumed when LLM_REQUESTS_PER_MINUTE isn't set.
+const defaultRequestsPerMinute = 60
+
+// Retries back off exponentially from retryBaseDelay up to retryMaxDelay, and give up after retryAttempts tries.
+const (
+	retryAttempts  = 5
+	retryBaseDelay = time.Second
+	retryMaxDelay  = 30 * time.Second
+)
+
+// requestTimeout is how long a single attempt may take before it's abandoned and retried. Streamed replies
+// only have to start within it, since a long answer can take longer to finish.
+const requestTimeout = 2 * time.Minute
+
+// requestsPerMinute reads LLM_REQUESTS_PER_MINUTE, the quota every request to the model shares.
+func requestsPerMinute() int {
+	s := os.Getenv("LLM_REQUESTS_PER_MINUTE")
+	if s == "" {
+		return defaultRequestsPerMinute
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 {
+		slog.Error("invalid requests per minute, using the default", "requestsPerMinute", s)
+		return defaultRequestsPerMinute
+	}
+	return n
+}
+
+// rateLimiter spaces requests out evenly, so bursts such as an upload's batches stay within the quota.
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newRateLimiter(requestsPerMinute int) *rateLimiter {
+	return &rateLimiter{interval: time.Minute / time.Duration(requestsPerMinute)}
+}
+
+// wait blocks until the next request may be sent.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	at := time.Now()
+	if l.next.After(at) {
+		at = l.next
+	}
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+
+	return sleep(ctx, time.Until(at))
+}
+
+// retryingProvider is a Provider that waits for its turn under the rate limit before every request,
+// and retries the requests that fail for reasons that may pass.
+type retryingProvider struct {
+	Provider
+	limiter *rateLimiter
+	// timeout is how long each attempt may take
+	timeout time.Duration
+}
+
+// withRetries wraps a provider with a rate limit shared by all its requests and retries with backoff.
+func withRetries(p Provider, requestsPerMinute int) Provider {
+	return &retryingProvider{Provider: p, limiter: newRateLimiter(requestsPerMinute), timeout: requestTimeout}
+}
+
+func (p *retryingProvider) Generate(ctx context.Context, conversation Conversation) (string, error) {
+	var err error
+	for attempt := range retryAttempts {
+		if attempt > 0 {
+			slog.Warn("retrying model request", "attempt", attempt+1, "error", err)
+			if err := sleep(ctx, backoff(attempt)); err != nil {
+				return "", err
+			}
+		}
+		if err := p.limiter.wait(ctx); err != nil {
+			return "", err
+		}
+
+		// a hung provider would otherwise hold the request up forever
+		attemptCtx, cancel := context.WithTimeout(ctx, p.timeout)
+		var reply string
+		reply, err = p.Provider.Generate(attemptCtx, conversation)
+		cancel()
+		if err == nil || !Retryable(err) || ctx.Err() != nil {
+			return reply, err
+		}
+	}
+	return "", err
+}
+
+// Stream retries until the first chunk arrives. Once part of the reply has been yielded, starting over
+// would repeat it, so later errors are passed on.
+func (p *retryingProvider) Stream(ctx context.Context, conversation Conversation) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		var err error
+		for attempt := range retryAttempts {
+			if attempt > 0 {
+				slog.Warn("retrying model request", "attempt", attempt+1, "error", err)
+				if err := sleep(ctx, backoff(attempt)); err != nil {
+					yield("", err)
+					return
+				}
+			}
+			if err := p.limiter.wait(ctx); err != nil {
+				yield("", err)
+				return
+			}
+
+			var started, stopped bool
+			started, stopped, err = p.streamAttempt(ctx, conversation, yield)
+			if err == nil || stopped {
+				return
+			}
+			if started || !Retryable(err) || ctx.Err() != nil {
+				yield("", err)
+				return
+			}
+		}
+		yield("", err)
+	}
+}
+
+// streamAttempt streams one attempt at the reply, reporting whether any of it was yielded and whether
+// the consumer stopped iterating. The attempt is abandoned if the reply hasn't started within the timeout;
+// once it has, it may take as long as it needs.
+func (p *retryingProvider) streamAttempt(ctx context.Context, conversation Conversation, yield func(string, error) bool) (started, stopped bool, err error) {
+	attemptCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	timer := time.AfterFunc(p.timeout, func() { cancel(context.DeadlineExceeded) })
+	defer timer.Stop()
+
+	for chunk, err := range p.Provider.Stream(attemptCtx, conversation) {
+		if err != nil {
+			// the provider only sees its context canceled, the cause says it timed out
+			if cause := context.Cause(attemptCtx); cause != nil && ctx.Err() == nil {
+				err = fmt.Errorf("%w: %s", cause, err.Error())
+			}
+			return started, false, err
+		}
+		if !started {
+			started = true
+			timer.Stop()
+		}
+		if !yield(chunk, nil) {
+			return started, true, nil
+		}
+	}
+	return started, false, nil
+}
+
+// backoff is how long to wait before the given attempt: an exponentially growing delay with full jitter,
+// so clients that failed together don't retry together.
+func backoff(attempt int) time.Duration {
+	delay := min(retryBaseDelay<<(attempt-1), retryMaxDelay)
+	return rand.N(delay) + 1
+}
+
+// Retryable reports whether a request that failed with err may succeed if it's sent again: rate limits,
+// server errors and timeouts. Requests are already retried by the model, so a retryable error coming
+// out of it means the model is unavailable for now.
+func Retryable(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return retryableStatus(statusErr.StatusCode)
+	}
+	var googleErr *googleapi.Error
+	if errors.As(err, &googleErr) {
+		return retryableStatus(googleErr.Code)
+	}
+	// gRPC errors from Google's clients carry the HTTP status they map to
+	var httpErr interface{ HTTPCode() int }
+	if errors.As(err, &httpErr) {
+		return retryableStatus(httpErr.HTTPCode())
+	}
+	return false
+}
+
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
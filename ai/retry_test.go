@@ -0,0 +1,154 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "rate limited", err: &StatusError{StatusCode: 429}, want: true},
+		{name: "server error", err: &StatusError{StatusCode: 500}, want: true},
+		{name: "unavailable", err: &StatusError{StatusCode: 503}, want: true},
+		{name: "wrapped", err: fmt.Errorf("failed to generate: %w", &StatusError{StatusCode: 502}), want: true},
+		{name: "bad request", err: &StatusError{StatusCode: 400}, want: false},
+		{name: "unauthorized", err: &StatusError{StatusCode: 401}, want: false},
+		{name: "google rate limited", err: &googleapi.Error{Code: 429}, want: true},
+		{name: "google not found", err: &googleapi.Error{Code: 404}, want: false},
+		{name: "deadline", err: context.DeadlineExceeded, want: true},
+		{name: "canceled", err: context.Canceled, want: false},
+		{name: "network timeout", err: &net.OpError{Op: "dial", Err: timeoutError{}}, want: true},
+		{name: "other", err: errors.New("invalid reply"), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Retryable(tt.err); got != tt.want {
+				t.Errorf("Retryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// timeoutError is a net.Error that timed out.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestBackoff(t *testing.T) {
+	for attempt := 1; attempt <= 10; attempt++ {
+		limit := min(retryBaseDelay<<(attempt-1), retryMaxDelay)
+		for range 100 {
+			if got := backoff(attempt); got <= 0 || got > limit {
+				t.Fatalf("backoff(%d) = %v, want it in (0, %v]", attempt, got, limit)
+			}
+		}
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter(6000)
+	if l.interval != 10*time.Millisecond {
+		t.Fatalf("interval = %v, want 10ms", l.interval)
+	}
+
+	start := time.Now()
+	for range 4 {
+		if err := l.wait(context.Background()); err != nil {
+			t.Fatalf("wait() error = %v", err)
+		}
+	}
+	// the first request goes straight away, the other three wait their turn
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("4 requests took %v, want at least 30ms", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	l = newRateLimiter(1)
+	l.wait(ctx)
+	if err := l.wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("wait() error = %v, want context.Canceled", err)
+	}
+}
+
+// hangingProvider hangs on its first request until the request's context is done, and answers the rest.
+type hangingProvider struct {
+	stubProvider
+	calls int
+}
+
+func (p *hangingProvider) Generate(ctx context.Context, conversation Conversation) (string, error) {
+	p.calls++
+	if p.calls == 1 {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+	return p.stubProvider.Generate(ctx, conversation)
+}
+
+func (p *hangingProvider) Stream(ctx context.Context, conversation Conversation) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		reply, err := p.Generate(ctx, conversation)
+		yield(reply, err)
+	}
+}
+
+func TestRetryingProviderTimeout(t *testing.T) {
+	t.Run("generate", func(t *testing.T) {
+		provider := &hangingProvider{stubProvider: stubProvider{reply: "ok"}}
+		p := &retryingProvider{Provider: provider, limiter: newRateLimiter(6000), timeout: 10 * time.Millisecond}
+
+		reply, err := p.Generate(context.Background(), Conversation{})
+		if err != nil || reply != "ok" {
+			t.Fatalf("Generate() = %q, %v, want ok", reply, err)
+		}
+		if provider.calls != 2 {
+			t.Errorf("provider was called %d times, want 2", provider.calls)
+		}
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		provider := &hangingProvider{stubProvider: stubProvider{reply: "ok"}}
+		p := &retryingProvider{Provider: provider, limiter: newRateLimiter(6000), timeout: 10 * time.Millisecond}
+
+		var reply string
+		for chunk, err := range p.Stream(context.Background(), Conversation{}) {
+			if err != nil {
+				t.Fatalf("Stream() error = %v", err)
+			}
+			reply += chunk
+		}
+		if reply != "ok" || provider.calls != 2 {
+			t.Errorf("Stream() = %q after %d calls, want ok after 2", reply, provider.calls)
+		}
+	})
+
+	t.Run("caller's deadline", func(t *testing.T) {
+		provider := &hangingProvider{}
+		p := &retryingProvider{Provider: provider, limiter: newRateLimiter(6000), timeout: time.Minute}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		// the caller ran out of time, so it isn't retried
+		if _, err := p.Generate(ctx, Conversation{}); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Generate() error = %v, want context.DeadlineExceeded", err)
+		}
+		if provider.calls != 1 {
+			t.Errorf("provider was called %d times, want 1", provider.calls)
+		}
+	})
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"awesomeProject/money"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// BalanceStrictness decides what happens to an import whose running balance doesn't add up.
+type BalanceStrictness string
+
+const (
+	// BalanceOff skips the check.
+	BalanceOff BalanceStrictness = "off"
+	// BalanceFlag imports the statement anyway and lists the gaps in the report.
+	BalanceFlag BalanceStrictness = "flag"
+	// BalanceStrict refuses to import a statement with gaps.
+	BalanceStrict BalanceStrictness = "strict"
+)
+
+// balanceStrictness reads the strictness from the request, falling back to BALANCE_CHECK and then to flagging.
+func balanceStrictness(requested string) (BalanceStrictness, error) {
+	if requested == "" {
+		requested = os.Getenv("BALANCE_CHECK")
+	}
+
+	switch s := BalanceStrictness(requested); s {
+	case "":
+		return BalanceFlag, nil
+	case BalanceOff, BalanceFlag, BalanceStrict:
+		return s, nil
+	default:
+		return "", fmt.Errorf("unknown balance check %q, expected off, flag or strict", requested)
+	}
+}
+
+// BalanceGap is a break in the running balance between two consecutive rows, which usually means
+// rows are missing from the statement or one of them was mis-parsed.
+type BalanceGap struct {
+	AfterLine       int         `json:"afterLine"`
+	BeforeLine      int         `json:"beforeLine"`
+	ExpectedBalance money.Money `json:"expectedBalance"`
+	ActualBalance   money.Money `json:"actualBalance"`
+	// MissingAmount is the net amount of the missing rows; positive when money came in, negative when it went out.
+	MissingAmount money.Money `json:"missingAmount"`
+}
+
+func (g BalanceGap) String() string {
+	return fmt.Sprintf("between lines %d and %d: expected balance %s, found %s (missing %s)",
+		g.AfterLine, g.BeforeLine, g.ExpectedBalance, g.ActualBalance, g.MissingAmount)
+}
+
+// signedAmount is the amount the transaction added to the balance.
+func (t *Transaction) signedAmount() money.Money {
+	if t.Type == -1 {
+		return -t.Amount
+	}
+	return t.Amount
+}
+
+// validateBalances checks that every row's balance follows from the previous row's balance and its own amount.
+// Statements may list transactions oldest or newest first, so both orders are tried and the one
+// that fits better is used.
+func validateBalances(transactions []*Transaction) []BalanceGap {
+	var checker balanceChecker
+	for _, t := range transactions {
+		checker.add(t)
+	}
+	return checker.gaps()
+}
+
+// balanceChecker validates the running balance as rows are read, one pair of consecutive rows at a time.
+// Both orders are checked as it goes, since the order of a statement isn't known until its end.
+type balanceChecker struct {
+	prev        *Transaction
+	oldestFirst []BalanceGap
+	newestFirst []BalanceGap
+}
+
+func (c *balanceChecker) add(t *Transaction) {
+	if c.prev != nil {
+		if gap, ok := balanceGap(c.prev, t); ok {
+			c.oldestFirst = append(c.oldestFirst, gap)
+		}
+		if gap, ok := balanceGap(t, c.prev); ok {
+			c.newestFirst = append(c.newestFirst, gap)
+		}
+	}
+	c.prev = t
+}
+
+// gaps returns the breaks in the running balance for whichever order fits the statement better,
+// listed in chronological order.
+func (c *balanceChecker) gaps() []BalanceGap {
+	if len(c.oldestFirst) == 0 {
+		return nil
+	}
+	if len(c.newestFirst) < len(c.oldestFirst) {
+		gaps := slices.Clone(c.newestFirst)
+		slices.Reverse(gaps)
+		return gaps
+	}
+	return c.oldestFirst
+}
+
+// balanceGap checks the balance of next against the transaction that came just before it.
+func balanceGap(prev, next *Transaction) (BalanceGap, bool) {
+	expected := prev.Balance + next.signedAmount()
+	if expected == next.Balance {
+		return BalanceGap{}, false
+	}
+
+	return BalanceGap{
+		AfterLine:       prev.Line,
+		BeforeLine:      next.Line,
+		ExpectedBalance: expected,
+		ActualBalance:   next.Balance,
+		MissingAmount:   next.Balance - expected,
+	}, true
+}
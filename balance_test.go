@@ -0,0 +1,90 @@
+package main
+
+import (
+	"awesomeProject/money"
+	"testing"
+)
+
+// balanceRow is a transaction with just enough set for the balance check: a positive amount is a credit.
+func balanceRow(line int, amount, balance money.Money) *Transaction {
+	t := &Transaction{Line: line, Amount: amount, Balance: balance}
+	t.setType(amount < 0)
+	if amount < 0 {
+		t.Amount = -amount
+	}
+	return t
+}
+
+func TestValidateBalances(t *testing.T) {
+	tests := []struct {
+		name string
+		rows []*Transaction
+		want []BalanceGap
+	}{
+		{
+			name: "oldest first",
+			rows: []*Transaction{balanceRow(1, 1000, 1000), balanceRow(2, -300, 700), balanceRow(3, 500, 1200)},
+		},
+		{
+			name: "newest first",
+			rows: []*Transaction{balanceRow(1, 500, 1200), balanceRow(2, -300, 700), balanceRow(3, 1000, 1000)},
+		},
+		{
+			name: "single row",
+			rows: []*Transaction{balanceRow(1, 500, 1200)},
+		},
+		{
+			name: "missing row oldest first",
+			rows: []*Transaction{balanceRow(1, 1000, 1000), balanceRow(2, -300, 700), balanceRow(3, 500, 1000)},
+			want: []BalanceGap{{AfterLine: 2, BeforeLine: 3, ExpectedBalance: 1200, ActualBalance: 1000, MissingAmount: -200}},
+		},
+		{
+			name: "missing rows newest first",
+			rows: []*Transaction{
+				balanceRow(1, 600, 1000), balanceRow(2, -200, 500), balanceRow(3, 100, 700),
+				balanceRow(4, -300, 200), balanceRow(5, 500, 500),
+			},
+			// listed in the order they happened
+			want: []BalanceGap{
+				{AfterLine: 4, BeforeLine: 3, ExpectedBalance: 300, ActualBalance: 700, MissingAmount: 400},
+				{AfterLine: 2, BeforeLine: 1, ExpectedBalance: 1100, ActualBalance: 1000, MissingAmount: -100},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := validateBalances(tt.rows)
+			if len(got) != len(tt.want) {
+				t.Fatalf("validateBalances() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("validateBalances() gap %d = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBalanceStrictness(t *testing.T) {
+	t.Setenv("BALANCE_CHECK", "strict")
+
+	tests := []struct {
+		requested string
+		want      BalanceStrictness
+		err       bool
+	}{
+		{requested: "", want: BalanceStrict},
+		{requested: "off", want: BalanceOff},
+		{requested: "flag", want: BalanceFlag},
+		{requested: "loose", err: true},
+	}
+
+	for _, tt := range tests {
+		got, err := balanceStrictness(tt.requested)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("balanceStrictness(%q) = %q, %v, want %q", tt.requested, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"awesomeProject/graph"
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// localConfidence is how sure the local classifier has to be for its answer to be used without asking the model.
+const localConfidence = 0.95
+
+// localMinExamples is how many saved transactions a category needs before the local classifier is trusted
+// to skip the model for it.
+const localMinExamples = 3
+
+// bayesClassifier is a naive Bayes classifier over the words of a transaction's party and description,
+// trained from transactions already in the graph. It works offline, so it's a cheap first pass and the
+// fallback for when the model isn't available.
+type bayesClassifier struct {
+	// examples is the number of training transactions per category
+	examples map[string]int
+	// tokens counts the words seen in each category, and totals is their sum per category
+	tokens map[string]map[string]int
+	totals map[string]int
+	// vocabulary is every word seen in training
+	vocabulary map[string]bool
+	size       int
+}
+
+func newBayesClassifier() *bayesClassifier {
+	return &bayesClassifier{
+		examples:   make(map[string]int),
+		tokens:     make(map[string]map[string]int),
+		totals:     make(map[string]int),
+		vocabulary: make(map[string]bool),
+	}
+}
+
+// trainBayesClassifier trains a classifier from the categorized transactions in the graph. Transactions the
+// categorizer wasn't confident about are left out unless the user has reviewed them, and so are transactions
+// in categories that no longer take transactions.
+func trainBayesClassifier(ctx context.Context, conn *graph.Conn, categories categorySet) (*bayesClassifier, error) {
+	res, err := conn.Execute(ctx, `
+	MATCH (t:Transaction)-[:BELONGS_TO]->(c:Category)
+	WHERE c.name <> $unknown AND (t.reviewedAt IS NOT NULL OR t.confidence IS NULL OR t.confidence >= $threshold)
+	RETURN c.name AS category, t.type AS type, coalesce(t.party, "") AS party, coalesce(t.description, "") AS description`,
+		map[string]interface{}{"unknown": unknownCategory, "threshold": reviewConfidence()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load training transactions: %s", err.Error())
+	}
+
+	choices := categories.choices()
+	classifier := newBayesClassifier()
+	for _, record := range res.Records {
+		category, _, _ := neo4j.GetRecordValue[string](record, "category")
+		if !slices.Contains(choices, category) {
+			continue
+		}
+		transactionType, _, _ := neo4j.GetRecordValue[string](record, "type")
+		party, _, _ := neo4j.GetRecordValue[string](record, "party")
+		description, _, _ := neo4j.GetRecordValue[string](record, "description")
+
+		t := &Transaction{Party: party, Description: description}
+		t.setType(transactionType == "Debit")
+		classifier.add(t, category)
+	}
+	return classifier, nil
+}
+
+// add trains the classifier with a categorized transaction.
+func (b *bayesClassifier) add(t *Transaction, category string) {
+	if b.tokens[category] == nil {
+		b.tokens[category] = make(map[string]int)
+	}
+	b.examples[category]++
+	b.size++
+	for _, token := range transactionTokens(t) {
+		b.tokens[category][token]++
+		b.totals[category]++
+		b.vocabulary[token] = true
+	}
+}
+
+// predict returns the most likely category of a transaction and its probability. It reports false when
+// none of the words of its party or description were seen in training, since the answer would only reflect
+// how common each category is.
+func (b *bayesClassifier) predict(t *Transaction) (string, float64, bool) {
+	if b == nil || b.size == 0 {
+		return "", 0, false
+	}
+
+	// the type alone says little, at least one word of the party or description has to be known
+	var known []string
+	words := 0
+	for _, token := range transactionTokens(t) {
+		if b.vocabulary[token] {
+			known = append(known, token)
+			if !strings.HasPrefix(token, "type:") {
+				words++
+			}
+		}
+	}
+	if words == 0 {
+		return "", 0, false
+	}
+
+	// log probabilities with Laplace smoothing, so a word missing from a category doesn't rule it out
+	scores := make(map[string]float64, len(b.examples))
+	best, bestScore := "", math.Inf(-1)
+	vocabulary := float64(len(b.vocabulary))
+	for category, examples := range b.examples {
+		score := math.Log(float64(examples) / float64(b.size))
+		for _, token := range known {
+			score += math.Log(float64(b.tokens[category][token]+1) / (float64(b.totals[category]) + vocabulary))
+		}
+		scores[category] = score
+		if score > bestScore || (score == bestScore && category < best) {
+			best, bestScore = category, score
+		}
+	}
+
+	var sum float64
+	for _, score := range scores {
+		sum += math.Exp(score - bestScore)
+	}
+	return best, 1 / sum, true
+}
+
+// confident reports whether a prediction is good enough to skip the model.
+func (b *bayesClassifier) confident(category string, probability float64) bool {
+	return probability >= localConfidence && b.examples[category] >= localMinExamples
+}
+
+// transactionTokens splits a transaction into the words the classifier learns from. Words from the party
+// and the description are kept apart, since "food" as a description says more than in a business name.
+func transactionTokens(t *Transaction) []string {
+	tokens := []string{"type:" + strings.ToLower(t.TypeString)}
+	for prefix, text := range map[string]string{"party:": t.Party, "description:": t.Description} {
+		words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		for _, w := range words {
+			if len(w) < 2 {
+				continue
+			}
+			tokens = append(tokens, prefix+w)
+		}
+	}
+	return tokens
+}
@@ -0,0 +1,104 @@
+package main
+
+import "testing"
+
+// bayesTransaction is a transaction with just the fields the classifier learns from.
+func bayesTransaction(debit bool, party, description string) *Transaction {
+	t := &Transaction{Party: party, Description: description}
+	t.setType(debit)
+	return t
+}
+
+func TestBayesPredict(t *testing.T) {
+	b := newBayesClassifier()
+	for range 5 {
+		b.add(bayesTransaction(true, "Mama Put Kitchen/1234567890/Providus", "lunch"), "Food")
+	}
+	b.add(bayesTransaction(true, "IKEDC/0011223344/Zenith", "prepaid token"), "Electricity Bill")
+	b.add(bayesTransaction(true, "IKEDC/0011223344/Zenith", "prepaid token"), "Electricity Bill")
+	b.add(bayesTransaction(false, "JOHN DOE/0123456789/GTBank", "salary march"), "Salary")
+
+	tests := []struct {
+		name      string
+		t         *Transaction
+		category  string
+		ok        bool
+		confident bool
+	}{
+		{name: "well known party", t: bayesTransaction(true, "Mama Put Kitchen/1234567890/Providus", "lunch"), category: "Food", ok: true, confident: true},
+		{name: "known description from a new party", t: bayesTransaction(true, "New Place", "lunch"), category: "Food", ok: true},
+		// two examples aren't enough to skip the model, however sure it is
+		{name: "too few examples", t: bayesTransaction(true, "IKEDC/0011223344/Zenith", "prepaid token"), category: "Electricity Bill", ok: true},
+		{name: "only the type is known", t: bayesTransaction(true, "Someone New", "x"), ok: false},
+		{name: "nothing known", t: bayesTransaction(false, "", ""), ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			category, p, ok := b.predict(tt.t)
+			if ok != tt.ok {
+				t.Fatalf("predict() ok = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if category != tt.category {
+				t.Errorf("predict() = %q, want %q", category, tt.category)
+			}
+			if p <= 0 || p > 1 {
+				t.Errorf("predict() probability = %v, want it in (0, 1]", p)
+			}
+			if confident := b.confident(category, p); confident != tt.confident {
+				t.Errorf("confident(%q, %v) = %v, want %v", category, p, confident, tt.confident)
+			}
+		})
+	}
+}
+
+func TestBayesPredictUntrained(t *testing.T) {
+	var b *bayesClassifier
+	if _, _, ok := b.predict(bayesTransaction(true, "Mama Put", "lunch")); ok {
+		t.Error("nil classifier predicted a category")
+	}
+	if _, _, ok := newBayesClassifier().predict(bayesTransaction(true, "Mama Put", "lunch")); ok {
+		t.Error("untrained classifier predicted a category")
+	}
+}
+
+func TestBayesConfident(t *testing.T) {
+	b := newBayesClassifier()
+	for range localMinExamples {
+		b.add(bayesTransaction(true, "Mama Put", "lunch"), "Food")
+	}
+
+	tests := []struct {
+		category string
+		p        float64
+		want     bool
+	}{
+		{category: "Food", p: localConfidence, want: true},
+		{category: "Food", p: localConfidence - 0.01, want: false},
+		{category: "Drinks", p: 1, want: false},
+	}
+	for _, tt := range tests {
+		if got := b.confident(tt.category, tt.p); got != tt.want {
+			t.Errorf("confident(%q, %v) = %v, want %v", tt.category, tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestTransactionTokens(t *testing.T) {
+	got := transactionTokens(bayesTransaction(true, "Mama-Put/1234567890", "Lunch & a drink"))
+	want := map[string]bool{
+		"type:debit": true, "party:mama": true, "party:put": true, "party:1234567890": true,
+		"description:lunch": true, "description:drink": true,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("transactionTokens() = %q, want %d tokens", got, len(want))
+	}
+	for _, token := range got {
+		if !want[token] {
+			t.Errorf("transactionTokens() has unexpected token %q", token)
+		}
+	}
+}
@@ -0,0 +1,482 @@
+package main
+
+import (
+	"awesomeProject/ai"
+	"awesomeProject/db"
+	"awesomeProject/graph"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"gorm.io/gorm"
+)
+
+// unknownCategory is saved for transactions nobody could categorize, so they can be reviewed later.
+const unknownCategory = "UNKNOWN"
+
+// loansCategory groups the loan categories, so questions about loans can take in all of them.
+const loansCategory = "Loans"
+
+// defaultCategories are the categories a new graph is seeded with. Once seeded, categories are managed
+// through the API and read back with loadCategories.
+var defaultCategories = categorySet{
+	{Name: "Family"},
+	{Name: "Girlfriend"},
+	{Name: "Food"},
+	{Name: "Internet/Airtime"},
+	{Name: "Clothing"},
+	{Name: "Debt"},
+	{Name: "Cowrywise In"},
+	{Name: "Cowrywise Out"},
+	{Name: "Electricity Bill"},
+	{Name: "Miscellaneous"},
+	{Name: "Church"},
+	{Name: "Transportation"},
+	{Name: "Personal Care"},
+	{Name: "Subscriptions"},
+	{Name: "Drinks"},
+	{Name: loansCategory, Description: "money lent or borrowed, and paid back"},
+	{Name: "LoanPayment-Out", Parent: loansCategory, Description: "for when it's a loan-related transaction and the user is the debtor. It has to be a debit transaction"},
+	{Name: "LoanPayment-In", Parent: loansCategory, Description: "for when it's a loan-related transaction and the user is the creditor. It has to be a credit transaction"},
+	{Name: "LoanRepayment-Out", Parent: loansCategory, Description: "for when the user repays a loan and is the debtor. It has to be a debit transaction"},
+	{Name: "LoanRepayment-In", Parent: loansCategory, Description: "for when the user receives payment for a loan and is the creditor. It has to be a credit transaction"},
+	{Name: "Salary"},
+	{Name: bankChargesCategory, Description: "transfer fees, levies, VAT and stamp duty charged by the bank"},
+}
+
+// categorySet is the set of categories transactions can be saved under, besides unknownCategory.
+type categorySet []ai.Category
+
+// choices are the categories a transaction can be saved under: the ones without others grouped under them.
+func (s categorySet) choices() []string {
+	parents := make(map[string]bool)
+	for _, c := range s {
+		if c.Parent != "" {
+			parents[c.Parent] = true
+		}
+	}
+
+	var names []string
+	for _, c := range s {
+		if !parents[c.Name] {
+			names = append(names, c.Name)
+		}
+	}
+	return names
+}
+
+// categorySynonyms maps answers the model is known to give, by their categoryKey, to the category they mean.
+// A synonym is only used while the category it points to exists.
+var categorySynonyms = map[string]string{
+	"feeding":             "Food",
+	"foodstuff":           "Food",
+	"foodstuffs":          "Food",
+	"groceries":           "Food",
+	"restaurant":          "Food",
+	"airtime":             "Internet/Airtime",
+	"data":                "Internet/Airtime",
+	"internet":            "Internet/Airtime",
+	"mobiledata":          "Internet/Airtime",
+	"clothes":             "Clothing",
+	"electricity":         "Electricity Bill",
+	"power":               "Electricity Bill",
+	"nepa":                "Electricity Bill",
+	"misc":                "Miscellaneous",
+	"tithe":               "Church",
+	"offering":            "Church",
+	"transport":           "Transportation",
+	"subscription":        "Subscriptions",
+	"drink":               "Drinks",
+	"loanpaymentdebit":    "LoanPayment-Out",
+	"loanpaymentdbt":      "LoanPayment-Out",
+	"loanpaymentcredit":   "LoanPayment-In",
+	"loanpaymentcrdt":     "LoanPayment-In",
+	"loanrepaymentdebit":  "LoanRepayment-Out",
+	"loanrepaymentdbt":    "LoanRepayment-Out",
+	"loanrepaymentcredit": "LoanRepayment-In",
+	"loanrepaymentcrdt":   "LoanRepayment-In",
+	"bankcharge":          bankChargesCategory,
+	"charges":             bankChargesCategory,
+	"fees":                bankChargesCategory,
+	"unknown":             unknownCategory,
+	"uncategorized":       unknownCategory,
+	"none":                unknownCategory,
+}
+
+// categoryKey reduces a category to its lowercase letters and digits, so "Internet & Airtime",
+// "internet/airtime" and "Internet/Airtime." all compare equal.
+func categoryKey(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, s)
+}
+
+// normalize maps an answer from the model onto the categories, ignoring case and punctuation, then
+// through the known synonyms, and finally to the closest category when it's a near miss such as a typo.
+// Groups such as Loans are too vague to save a transaction under, so they aren't matched.
+// It reports false when the answer can't be mapped.
+func (s categorySet) normalize(answer string) (string, bool) {
+	key := categoryKey(answer)
+	if key == "" {
+		return "", false
+	}
+	if key == categoryKey(unknownCategory) {
+		return unknownCategory, true
+	}
+
+	choices := s.choices()
+	for _, c := range choices {
+		if categoryKey(c) == key {
+			return c, true
+		}
+	}
+	if c, ok := categorySynonyms[key]; ok {
+		if c == unknownCategory || slices.Contains(choices, c) {
+			return c, true
+		}
+	}
+
+	// short keys are too easily one edit from another category
+	maxDistance := 1
+	if len(key) >= 8 {
+		maxDistance = 2
+	}
+
+	best, bestDistance, tied := "", maxDistance+1, false
+	for _, c := range choices {
+		d := editDistance(key, categoryKey(c))
+		switch {
+		case d < bestDistance:
+			best, bestDistance, tied = c, d, false
+		case d == bestDistance:
+			tied = true
+		}
+	}
+	if best == "" || tied {
+		return "", false
+	}
+	return best, true
+}
+
+// editDistance is the Levenshtein distance between two strings.
+func editDistance(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+	prev := make([]int, len(br)+1)
+	curr := make([]int, len(br)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ar); i++ {
+		curr[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(br)]
+}
+
+// Reasons a category change can be refused.
+var (
+	ErrCategoryExists = errors.New("category already exists")
+	ErrCategoryInUse  = errors.New("category is in use")
+	ErrUnknownParent  = errors.New("unknown parent category")
+	ErrCategoryCycle  = errors.New("category can't be grouped under itself")
+	ErrCategoryName   = errors.New("category name is required")
+	// ErrUnknownCategory is returned when a transaction is moved to a category that doesn't exist, or is a group.
+	ErrUnknownCategory = errors.New("unknown category")
+)
+
+// categoryErrorStatus is the HTTP status for an error from changing a category.
+func categoryErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrCategoryExists), errors.Is(err, ErrCategoryInUse):
+		return http.StatusConflict
+	case errors.Is(err, ErrUnknownParent), errors.Is(err, ErrCategoryCycle), errors.Is(err, ErrCategoryName),
+		errors.Is(err, ErrUnknownCategory):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// builtinCategories are used by the importer itself, so they can't be renamed or deleted.
+var builtinCategories = []string{bankChargesCategory, unknownCategory}
+
+// loadCategories reads the stored categories, in name order.
+func loadCategories(ctx context.Context, conn *graph.Conn) (categorySet, error) {
+	res, err := conn.Execute(ctx, `
+	MATCH (c:Category)
+	WHERE c.name <> $unknown
+	OPTIONAL MATCH (c)-[:CHILD_OF]->(p:Category)
+	RETURN c.name AS name, coalesce(c.description, "") AS description, coalesce(p.name, "") AS parent
+	ORDER BY c.name`, map[string]interface{}{"unknown": unknownCategory})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load categories: %s", err.Error())
+	}
+
+	categories := make(categorySet, 0, len(res.Records))
+	for _, record := range res.Records {
+		var c ai.Category
+		if c.Name, _, err = neo4j.GetRecordValue[string](record, "name"); err != nil {
+			return nil, err
+		}
+		if c.Description, _, err = neo4j.GetRecordValue[string](record, "description"); err != nil {
+			return nil, err
+		}
+		if c.Parent, _, err = neo4j.GetRecordValue[string](record, "parent"); err != nil {
+			return nil, err
+		}
+		categories = append(categories, c)
+	}
+	return categories, nil
+}
+
+// listCategories returns every category with its parent and the number of transactions in it.
+func listCategories(ctx context.Context, conn *graph.Conn) ([]map[string]any, error) {
+	res, err := conn.Execute(ctx, `
+	MATCH (c:Category)
+	OPTIONAL MATCH (c)-[:CHILD_OF]->(p:Category)
+	RETURN c, p.name AS parent, COUNT { (:Transaction)-[:BELONGS_TO]->(c) } AS transactions
+	ORDER BY c.name`, map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+
+	categories := make([]map[string]any, 0, len(res.Records))
+	for _, record := range res.Records {
+		node, _, err := neo4j.GetRecordValue[neo4j.Node](record, "c")
+		if err != nil {
+			return nil, err
+		}
+		parent, _ := record.Get("parent")
+		count, _, err := neo4j.GetRecordValue[int64](record, "transactions")
+		if err != nil {
+			return nil, err
+		}
+
+		category := node.Props
+		category["parent"] = parent
+		category["transactions"] = count
+		categories = append(categories, category)
+	}
+	return categories, nil
+}
+
+// createCategory adds a category and returns its id. Names that only differ from an existing one
+// in case or punctuation are refused, since answers from the model couldn't tell them apart.
+func createCategory(ctx context.Context, conn *graph.Conn, sqlite *db.DB, c ai.Category) (string, error) {
+	existing, err := loadCategories(ctx, conn)
+	if err != nil {
+		return "", err
+	}
+	if err := checkCategory(existing, "", c); err != nil {
+		return "", err
+	}
+	if err := checkParent(ctx, conn, sqlite, existing, c.Parent); err != nil {
+		return "", err
+	}
+
+	res, err := conn.Execute(ctx, `
+	CREATE (c:Category {id: randomUUID(), name: $name, description: $description})
+	WITH c
+	OPTIONAL MATCH (p:Category {name: $parent})
+	FOREACH (_ IN CASE WHEN p IS NULL THEN [] ELSE [1] END | MERGE (c)-[:CHILD_OF]->(p))
+	RETURN c.id AS id`, map[string]interface{}{"name": c.Name, "description": c.Description, "parent": c.Parent})
+	if err != nil {
+		return "", err
+	}
+	if len(res.Records) == 0 {
+		return "", fmt.Errorf("failed to create category: no record returned")
+	}
+
+	id, _, err := neo4j.GetRecordValue[string](res.Records[0], "id")
+	return id, err
+}
+
+// updateCategory renames, redescribes or regroups a category. Its transactions, the rules, people and vendors
+// referring to it and the corrections made to it follow it. It returns false if there's no such category.
+func updateCategory(ctx context.Context, conn *graph.Conn, sqlite *db.DB, id string, c ai.Category) (bool, error) {
+	res, err := conn.Execute(ctx, `MATCH (c:Category {id: $id}) RETURN c.name AS name`, map[string]interface{}{"id": id})
+	if err != nil {
+		return false, err
+	}
+	if len(res.Records) == 0 {
+		return false, nil
+	}
+	current, _, err := neo4j.GetRecordValue[string](res.Records[0], "name")
+	if err != nil {
+		return true, err
+	}
+
+	if current != c.Name && slices.Contains(builtinCategories, current) {
+		return true, fmt.Errorf("%w: %s is used by the importer and can't be renamed", ErrCategoryInUse, current)
+	}
+
+	existing, err := loadCategories(ctx, conn)
+	if err != nil {
+		return true, err
+	}
+	if err := checkCategory(existing, current, c); err != nil {
+		return true, err
+	}
+	if err := checkParent(ctx, conn, sqlite, existing, c.Parent); err != nil {
+		return true, err
+	}
+
+	// the parent can't be the category itself or anything grouped under it
+	if c.Parent != "" {
+		res, err := conn.Execute(ctx, `
+		MATCH (c:Category {id: $id}), (p:Category {name: $parent})
+		RETURN EXISTS { (p)-[:CHILD_OF*0..]->(c) } AS cycle`, map[string]interface{}{"id": id, "parent": c.Parent})
+		if err != nil {
+			return true, err
+		}
+		if len(res.Records) > 0 {
+			if cycle, _, _ := neo4j.GetRecordValue[bool](res.Records[0], "cycle"); cycle {
+				return true, ErrCategoryCycle
+			}
+		}
+	}
+
+	_, err = conn.Execute(ctx, `
+	MATCH (c:Category {id: $id})
+	SET c.name = $name, c.description = $description
+	WITH c
+	OPTIONAL MATCH (c)-[old:CHILD_OF]->()
+	DELETE old
+	WITH DISTINCT c
+	OPTIONAL MATCH (p:Category {name: $parent})
+	FOREACH (_ IN CASE WHEN p IS NULL THEN [] ELSE [1] END | MERGE (c)-[:CHILD_OF]->(p))`,
+		map[string]interface{}{"id": id, "name": c.Name, "description": c.Description, "parent": c.Parent})
+	if err != nil || current == c.Name {
+		return true, err
+	}
+
+	err = sqlite.Transaction(func(tx *gorm.DB) error {
+		for _, model := range []any{&db.CategoryRule{}, &db.ProfilePerson{}, &db.ProfileVendor{}} {
+			if err := tx.Model(model).Where("category = ?", current).Update("category", c.Name).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&db.CategoryCorrection{}).Where("\"to\" = ?", current).Update("to", c.Name).Error
+	})
+	if err != nil {
+		return true, fmt.Errorf("failed to rename category in rules and profile: %s", err.Error())
+	}
+	return true, nil
+}
+
+// deleteCategory deletes a category nothing belongs to or refers to. It returns false if there's no such category.
+func deleteCategory(ctx context.Context, conn *graph.Conn, sqlite *db.DB, id string) (bool, error) {
+	res, err := conn.Execute(ctx, `
+	MATCH (c:Category {id: $id})
+	RETURN c.name AS name, COUNT { (:Transaction)-[:BELONGS_TO]->(c) } AS transactions, COUNT { (:Category)-[:CHILD_OF]->(c) } AS children`,
+		map[string]interface{}{"id": id})
+	if err != nil {
+		return false, err
+	}
+	if len(res.Records) == 0 {
+		return false, nil
+	}
+
+	record := res.Records[0]
+	name, _, _ := neo4j.GetRecordValue[string](record, "name")
+	transactions, _, _ := neo4j.GetRecordValue[int64](record, "transactions")
+	children, _, _ := neo4j.GetRecordValue[int64](record, "children")
+	switch {
+	case slices.Contains(builtinCategories, name):
+		return true, fmt.Errorf("%w: %s is used by the importer", ErrCategoryInUse, name)
+	case transactions > 0:
+		return true, fmt.Errorf("%w: %d transactions belong to %s", ErrCategoryInUse, transactions, name)
+	case children > 0:
+		return true, fmt.Errorf("%w: %d categories are grouped under %s", ErrCategoryInUse, children, name)
+	}
+	if err := checkReferences(sqlite, name); err != nil {
+		return true, err
+	}
+
+	_, err = conn.Execute(ctx, `MATCH (c:Category {id: $id}) DETACH DELETE c`, map[string]interface{}{"id": id})
+	return true, err
+}
+
+// checkCategory validates a new or changed category against the existing ones. current is the name
+// of the category being changed, empty for a new one.
+func checkCategory(existing categorySet, current string, c ai.Category) error {
+	if strings.TrimSpace(c.Name) == "" || categoryKey(c.Name) == "" {
+		return ErrCategoryName
+	}
+	if categoryKey(c.Name) == categoryKey(unknownCategory) {
+		return fmt.Errorf("%w: %s", ErrCategoryExists, unknownCategory)
+	}
+
+	parentFound := c.Parent == ""
+	for _, e := range existing {
+		if e.Name != current && categoryKey(e.Name) == categoryKey(c.Name) {
+			return fmt.Errorf("%w: %s", ErrCategoryExists, e.Name)
+		}
+		if e.Name == c.Parent && e.Name != current {
+			parentFound = true
+		}
+	}
+	if !parentFound {
+		return fmt.Errorf("%w: %s", ErrUnknownParent, c.Parent)
+	}
+	return nil
+}
+
+// checkParent refuses to group categories under one that transactions belong to, or that rules or the
+// profile refer to. Nothing can be filed under a group, so those transactions would be stranded and the
+// rules and profile would stop loading.
+func checkParent(ctx context.Context, conn *graph.Conn, sqlite *db.DB, existing categorySet, parent string) error {
+	if parent == "" || !slices.Contains(existing.choices(), parent) {
+		return nil
+	}
+
+	res, err := conn.Execute(ctx, `
+	MATCH (p:Category {name: $parent})
+	RETURN COUNT { (:Transaction)-[:BELONGS_TO]->(p) } AS transactions`, map[string]interface{}{"parent": parent})
+	if err != nil {
+		return err
+	}
+	if len(res.Records) > 0 {
+		if transactions, _, _ := neo4j.GetRecordValue[int64](res.Records[0], "transactions"); transactions > 0 {
+			return fmt.Errorf("%w: %d transactions belong to %s", ErrCategoryInUse, transactions, parent)
+		}
+	}
+	return checkReferences(sqlite, parent)
+}
+
+// checkReferences returns ErrCategoryInUse if a rule, person or vendor refers to the category.
+func checkReferences(sqlite *db.DB, name string) error {
+	for _, ref := range []struct {
+		kind  string
+		model any
+	}{
+		{"rules", &db.CategoryRule{}},
+		{"people", &db.ProfilePerson{}},
+		{"vendors", &db.ProfileVendor{}},
+	} {
+		var count int64
+		if err := sqlite.Model(ref.model).Where("category = ?", name).Count(&count).Error; err != nil {
+			return fmt.Errorf("failed to check %s for category: %s", ref.kind, err.Error())
+		}
+		if count > 0 {
+			return fmt.Errorf("%w: %d %s refer to %s", ErrCategoryInUse, count, ref.kind, name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	// Food isn't in this set, so its synonyms mustn't map to it
+	pets := categorySet{{Name: "Cars"}, {Name: "Cats"}, {Name: "Pets"}, {Name: "Dogs", Parent: "Pets"}, {Name: "Fish", Parent: "Pets"}}
+
+	tests := []struct {
+		name       string
+		categories categorySet
+		answer     string
+		want       string
+		ok         bool
+	}{
+		{name: "exact", answer: "Food", want: "Food", ok: true},
+		{name: "case and punctuation", answer: "internet & airtime.", want: "Internet/Airtime", ok: true},
+		{name: "synonym", answer: "Groceries", want: "Food", ok: true},
+		{name: "synonym for a debit loan", answer: "Loan Payment (Debit)", want: "LoanPayment-Out", ok: true},
+		{name: "unknown", answer: "unknown", want: unknownCategory, ok: true},
+		{name: "synonym for unknown", answer: "Uncategorized", want: unknownCategory, ok: true},
+		{name: "typo", answer: "Fod", want: "Food", ok: true},
+		{name: "transposed letters in a long name", answer: "Clotihng", want: "Clothing", ok: true},
+		{name: "plural", answer: "Girlfriends", want: "Girlfriend", ok: true},
+		{name: "group", answer: "Loans", ok: false},
+		{name: "too far from anything", answer: "Holidays", ok: false},
+		{name: "empty", answer: " - ", ok: false},
+		{name: "synonym for a missing category", categories: pets, answer: "groceries", ok: false},
+		{name: "tie", categories: pets, answer: "Cabs", ok: false},
+		{name: "group in a custom set", categories: pets, answer: "pets", ok: false},
+		{name: "child in a custom set", categories: pets, answer: "dog", want: "Dogs", ok: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			categories := tt.categories
+			if categories == nil {
+				categories = defaultCategories
+			}
+			got, ok := categories.normalize(tt.answer)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("normalize(%q) = %q, %v, want %q, %v", tt.answer, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestChoices(t *testing.T) {
+	got := categorySet{{Name: "Loans"}, {Name: "Loan-In", Parent: "Loans"}, {Name: "Food"}}.choices()
+	if len(got) != 2 || got[0] != "Loan-In" || got[1] != "Food" {
+		t.Errorf("choices() = %q, want [Loan-In Food]", got)
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{a: "", b: "", want: 0},
+		{a: "", b: "abc", want: 3},
+		{a: "food", b: "food", want: 0},
+		{a: "kitten", b: "sitting", want: 3},
+		{a: "clotihng", b: "clothing", want: 2},
+		{a: "café", b: "cafe", want: 1},
+	}
+
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := editDistance(tt.b, tt.a); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.b, tt.a, got, tt.want)
+		}
+	}
+}
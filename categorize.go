@@ -0,0 +1,178 @@
+package main
+
+import (
+	"awesomeProject/ai"
+	"awesomeProject/db"
+	"awesomeProject/graph"
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+)
+
+// Categorizer decides the category of each imported transaction, trying the user's rules and then the local
+// classifier before the model. The local classifier is also the fallback when the model isn't available.
+type Categorizer struct {
+	// model is nil when no model is configured
+	model      ai.Model
+	rules      []*categoryRule
+	local      *bayesClassifier
+	categories categorySet
+	context    ai.CategoryContext
+	// sqlite holds the transactions queued to be categorized again
+	sqlite *db.DB
+}
+
+// newCategorizer loads the current categories, rules, profile and corrections and trains the local classifier,
+// so changes made since the last upload apply to the next one.
+func newCategorizer(model ai.Model, sqlite *db.DB) (*Categorizer, error) {
+	conn, err := graph.NewGraphConn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to graph database: %s", err.Error())
+	}
+	defer conn.Close()
+
+	categories, err := loadCategories(context.Background(), conn)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := loadRules(sqlite, categories)
+	if err != nil {
+		return nil, err
+	}
+	profile, err := loadProfile(sqlite)
+	if err != nil {
+		return nil, err
+	}
+	corrections, err := loadCorrections(sqlite, categories)
+	if err != nil {
+		return nil, err
+	}
+	// the import can go on without the local classifier, everything is left to the model
+	local, err := trainBayesClassifier(context.Background(), conn, categories)
+	if err != nil {
+		slog.Error("error: training local classifier", "error", err)
+	}
+	return &Categorizer{
+		model:      model,
+		rules:      rules,
+		local:      local,
+		categories: categories,
+		context:    ai.CategoryContext{Profile: profile, Categories: categories, Corrections: corrections},
+		sqlite:     sqlite,
+	}, nil
+}
+
+// categoryBatchSize is how many transactions the model is asked about in a single request.
+const categoryBatchSize = 25
+
+// categorizeLocally sets the category of the transaction when a fee, one of the rules or a confident answer
+// from the local classifier decides it, and reports whether it did.
+func (c *Categorizer) categorizeLocally(t *Transaction) bool {
+	if t.IsFee {
+		t.Category, t.Confidence, t.Reason = bankChargesCategory, 1, "detected as a bank fee"
+		return true
+	}
+
+	if rule := matchRule(c.rules, t); rule != nil {
+		t.Category, t.Confidence, t.Reason = rule.Category, 1, fmt.Sprintf("matched rule %q", rule.Name)
+		t.Rule = rule.ID.String()
+		return true
+	}
+
+	if category, probability, ok := c.local.predict(t); ok && c.local.confident(category, probability) {
+		t.Category, t.Confidence, t.Reason = category, probability, fmt.Sprintf("similar to earlier %s transactions", category)
+		return true
+	}
+	return false
+}
+
+// categorizeBatch asks the model for the categories of a batch of transactions in one request.
+// Rows the answer left out or got wrong are asked about one at a time, and rows the model couldn't
+// answer for fall back to the local classifier. Once the model is rate limited or down it isn't asked
+// about the rest of the batch. It returns the error for each row that's still without a category.
+func (c *Categorizer) categorizeBatch(batch []*Transaction) map[*Transaction]error {
+	failed := make(map[*Transaction]error)
+	if c.model == nil {
+		for _, t := range batch {
+			c.categorizeOffline(t)
+		}
+		return failed
+	}
+
+	requests := make([]ai.CategoryRequest, len(batch))
+	for i, t := range batch {
+		requests[i] = ai.CategoryRequest{ID: strconv.Itoa(i), Transaction: t.String()}
+	}
+
+	// requests are spaced out to fit the model's quota, and retried, by the model itself, so an error
+	// that's worth retrying means asking row by row would only add to the requests it's turning away
+	var unavailable error
+	predictions, err := c.model.PredictCategories(c.context, requests)
+	if err != nil {
+		if ai.Retryable(err) {
+			unavailable = err
+			slog.Error("error: batch categorization, the model is unavailable", "size", len(batch), "error", err)
+		} else {
+			slog.Error("error: batch categorization, asking one at a time", "size", len(batch), "error", err)
+		}
+	}
+
+	for i, t := range batch {
+		// answers outside the category list count as wrong, the row gets a second chance on its own
+		if prediction, ok := predictions[strconv.Itoa(i)]; ok {
+			if category, ok := c.categories.normalize(prediction.Category); ok {
+				t.Category, t.Confidence, t.Reason = category, prediction.Confidence, prediction.Reason
+				continue
+			}
+		}
+
+		err := unavailable
+		if err == nil {
+			var prediction ai.CategoryPrediction
+			if prediction, err = c.model.PredictCategory(c.context, t.String()); err == nil {
+				c.setModelCategory(t, prediction)
+				continue
+			}
+			if ai.Retryable(err) {
+				unavailable = err
+			}
+		}
+		if !c.setLocalCategory(t, "the model couldn't be reached") {
+			failed[t] = err
+		}
+	}
+	return failed
+}
+
+// categorizeOffline categorizes a transaction when there's no model. Transactions the local classifier
+// knows nothing like are saved as UNKNOWN, so they're queued for review rather than lost.
+func (c *Categorizer) categorizeOffline(t *Transaction) {
+	if !c.setLocalCategory(t, "no model is configured") {
+		t.Category, t.Confidence, t.Reason = unknownCategory, 0, "no model is configured and nothing similar has been categorized before"
+	}
+}
+
+// setLocalCategory sets the local classifier's answer, however unsure it is, and reports whether it had one.
+// Unsure answers keep their low confidence, so they're queued for review.
+func (c *Categorizer) setLocalCategory(t *Transaction, why string) bool {
+	category, probability, ok := c.local.predict(t)
+	if !ok {
+		return false
+	}
+	t.Category, t.Confidence, t.Reason = category, probability, fmt.Sprintf("%s, similar to earlier %s transactions", why, category)
+	return true
+}
+
+// setModelCategory sets the category the model answered with, mapped onto the category list.
+// Answers that can't be mapped are saved as UNKNOWN with no confidence, keeping the answer for review.
+func (c *Categorizer) setModelCategory(t *Transaction, prediction ai.CategoryPrediction) {
+	t.Reason = prediction.Reason
+	category, ok := c.categories.normalize(prediction.Category)
+	if !ok {
+		slog.Warn("model answered with an unknown category", "transaction", t.String(), "answer", prediction.Category)
+		t.Category, t.RawCategory, t.Confidence = unknownCategory, prediction.Category, 0
+		return
+	}
+	t.Category, t.Confidence = category, prediction.Confidence
+}
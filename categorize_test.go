@@ -0,0 +1,117 @@
+package main
+
+import (
+	"awesomeProject/ai"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func parseKudaLines(t *testing.T, lines ...string) []*Transaction {
+	t.Helper()
+	var transactions []*Transaction
+	for _, line := range lines {
+		transaction, err := parseLine(line)
+		if err != nil {
+			t.Fatalf("parseLine(%q): %v", line, err)
+		}
+		transactions = append(transactions, transaction)
+	}
+	return transactions
+}
+
+func TestCategorizeBatch(t *testing.T) {
+	script := []ai.FakeCategory{
+		{Match: "Mama Put", Category: "food", Confidence: 0.9},
+		{Match: "Rent contribution", Category: "Family", Confidence: 0.6},
+		{Match: "NETFLIX", Category: "Streaming services", Confidence: 0.8},
+	}
+
+	tests := []struct {
+		name string
+		fake *ai.Fake
+		// single is how many transactions are asked about on their own after the batch
+		single     int
+		categories []string
+		failed     int
+	}{
+		{
+			name:       "batch answers",
+			fake:       &ai.Fake{Categories: script},
+			single:     1,
+			categories: []string{"Family", "Food", unknownCategory},
+		},
+		{
+			name:       "batch fails",
+			fake:       &ai.Fake{Categories: script, BatchErr: errors.New("bad batch")},
+			single:     3,
+			categories: []string{"Family", "Food", unknownCategory},
+		},
+		{
+			name:   "model fails",
+			fake:   &ai.Fake{Categories: script, Err: errors.New("unavailable")},
+			single: 3,
+			failed: 3,
+		},
+		{
+			name:   "batch rate limited",
+			fake:   &ai.Fake{Categories: script, BatchErr: &ai.StatusError{StatusCode: http.StatusTooManyRequests}},
+			single: 0,
+			failed: 3,
+		},
+		{
+			name:   "model down",
+			fake:   &ai.Fake{Categories: script, Err: &ai.StatusError{StatusCode: http.StatusServiceUnavailable}},
+			single: 0,
+			failed: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Categorizer{model: tt.fake, categories: defaultCategories}
+			batch := parseKudaLines(t, kudaLines[0], kudaLines[1], kudaLines[3])
+
+			failed := c.categorizeBatch(batch)
+			if len(failed) != tt.failed {
+				t.Fatalf("failed = %d, want %d", len(failed), tt.failed)
+			}
+			if got := tt.fake.Calls("PredictCategory"); got != tt.single {
+				t.Errorf("PredictCategory calls = %d, want %d", got, tt.single)
+			}
+			if tt.failed > 0 {
+				return
+			}
+
+			for i, tr := range batch {
+				if tr.Category != tt.categories[i] {
+					t.Errorf("transaction %d: category = %q, want %q", i, tr.Category, tt.categories[i])
+				}
+			}
+			// the answer the category list has no place for is kept for review
+			if batch[2].RawCategory != "Streaming services" || batch[2].Confidence != 0 {
+				t.Errorf("unmapped answer: rawCategory = %q, confidence = %v", batch[2].RawCategory, batch[2].Confidence)
+			}
+		})
+	}
+}
+
+func TestCategorizeOffline(t *testing.T) {
+	local := newBayesClassifier()
+	for _, tr := range parseKudaLines(t, kudaLines[1], kudaLines[1], kudaLines[1]) {
+		local.add(tr, "Food")
+	}
+
+	c := &Categorizer{local: local, categories: defaultCategories}
+	batch := parseKudaLines(t, kudaLines[1], kudaLines[3])
+	if failed := c.categorizeBatch(batch); len(failed) != 0 {
+		t.Fatalf("failed = %d, want 0", len(failed))
+	}
+
+	if batch[0].Category != "Food" {
+		t.Errorf("known party: category = %q, want Food", batch[0].Category)
+	}
+	if batch[1].Category != unknownCategory || batch[1].Confidence != 0 {
+		t.Errorf("unknown party: category = %q, confidence = %v, want UNKNOWN with no confidence", batch[1].Category, batch[1].Confidence)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"awesomeProject/ai"
+	"awesomeProject/db"
+	"awesomeProject/graph"
+	"context"
+	"fmt"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// correctionExamples is how many of the latest corrections the model is shown when it categorizes.
+const correctionExamples = 20
+
+// correctCategory moves a transaction, identified by its fingerprint, to another category and records
+// the correction. The transaction counts as reviewed afterwards. It returns false if there's no such transaction.
+func correctCategory(ctx context.Context, conn *graph.Conn, sqlite *db.DB, categories categorySet, fingerprint, answer string) (*db.CategoryCorrection, bool, error) {
+	category, ok := categories.normalize(answer)
+	if !ok || category == unknownCategory {
+		return nil, false, fmt.Errorf("%w: %q", ErrUnknownCategory, answer)
+	}
+
+	res, err := conn.Execute(ctx, `
+	MATCH (t:Transaction {fingerprint: $fingerprint})
+	OPTIONAL MATCH (t)-[:BELONGS_TO]->(c:Category)
+	RETURN t.dateTime AS dateTime, t.amount AS amount, t.type AS type, t.balance AS balance, coalesce(t.currency, "NGN") AS currency,
+		coalesce(t.party, "") AS party, coalesce(t.description, "") AS description, coalesce(c.name, "") AS category`,
+		map[string]interface{}{"fingerprint": fingerprint})
+	if err != nil {
+		return nil, false, err
+	}
+	if len(res.Records) == 0 {
+		return nil, false, nil
+	}
+
+	record := res.Records[0]
+	t, err := transactionFromRecord(record)
+	if err != nil {
+		return nil, true, err
+	}
+	t.DateTime = t.DateTime.In(statementLocation())
+	from, _, _ := neo4j.GetRecordValue[string](record, "category")
+
+	correction := &db.CategoryCorrection{Fingerprint: fingerprint, Transaction: t.String(), From: from, To: category}
+
+	// the user has decided the category, so the rule that filed it, if any, and the model's reasoning no longer apply
+	_, err = conn.Execute(ctx, `
+	MATCH (t:Transaction {fingerprint: $fingerprint})
+	OPTIONAL MATCH (t)-[r:BELONGS_TO]->(:Category)
+	DELETE r
+	WITH DISTINCT t
+	MATCH (c:Category {name: $category})
+	MERGE (t)-[:BELONGS_TO]->(c)
+	SET t.rule = null, t.confidence = 1.0, t.reason = "set by the user", t.reviewedAt = datetime()`,
+		map[string]interface{}{"fingerprint": fingerprint, "category": category})
+	if err != nil {
+		return nil, true, err
+	}
+	if from == category {
+		return correction, true, nil
+	}
+
+	if err := sqlite.Create(correction).Error; err != nil {
+		return nil, true, fmt.Errorf("failed to record correction: %s", err.Error())
+	}
+	return correction, true, nil
+}
+
+// loadCorrections reads the latest corrections to show the model, one per transaction. Corrections to
+// categories that no longer take transactions are left out.
+func loadCorrections(sqlite *db.DB, categories categorySet) ([]ai.Correction, error) {
+	var records []db.CategoryCorrection
+	err := sqlite.Order("created_at DESC").Limit(correctionExamples * 2).Find(&records).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load corrections: %s", err.Error())
+	}
+
+	var corrections []ai.Correction
+	seen := make(map[string]bool)
+	for _, r := range records {
+		if seen[r.Fingerprint] {
+			continue
+		}
+		seen[r.Fingerprint] = true
+
+		if category, ok := categories.normalize(r.To); !ok || category != r.To {
+			continue
+		}
+		corrections = append(corrections, ai.Correction{Transaction: r.Transaction, Wrong: r.From, Category: r.To})
+		if len(corrections) == correctionExamples {
+			break
+		}
+	}
+	return corrections, nil
+}
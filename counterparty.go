@@ -0,0 +1,69 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Counterparty is the other side of a transaction, parsed from Kuda's "Name/AccountNumber/Bank Name" party field.
+type Counterparty struct {
+	Name          string `json:"name"`
+	AccountNumber string `json:"accountNumber"`
+	Bank          string `json:"bank"`
+}
+
+var (
+	accountNumberPattern = regexp.MustCompile(`^\d{6,}$`)
+	// partyPrefixPattern matches the channel Kuda prepends to some names, e.g. "Pos Transfer-Jane Doe"
+	partyPrefixPattern = regexp.MustCompile(`(?i)^(pos transfer|transfer from|transfer to)\s*-\s*`)
+)
+
+// parseCounterparty splits a party field into its name, account number and bank.
+// Names and bank names can themselves contain slashes, so the account number is taken to be the
+// last all-digit segment. Parties without an account number are treated as a bare name.
+// It returns nil for an empty party.
+func parseCounterparty(party string) *Counterparty {
+	party = strings.TrimSpace(party)
+	if party == "" {
+		return nil
+	}
+
+	segments := strings.Split(party, "/")
+	account := -1
+	for i := len(segments) - 1; i >= 0; i-- {
+		if accountNumberPattern.MatchString(strings.TrimSpace(segments[i])) {
+			account = i
+			break
+		}
+	}
+
+	c := &Counterparty{Name: party}
+	if account != -1 {
+		c.Name = strings.Join(segments[:account], "/")
+		c.AccountNumber = strings.TrimSpace(segments[account])
+		c.Bank = strings.TrimSpace(strings.Join(segments[account+1:], "/"))
+	}
+
+	c.Name = partyPrefixPattern.ReplaceAllString(strings.TrimSpace(c.Name), "")
+	c.Name = strings.Join(strings.Fields(c.Name), " ")
+	if c.Name == "" && c.AccountNumber == "" {
+		return nil
+	}
+	return c
+}
+
+// Key identifies the counterparty across transactions: the account, when there is one, and the name otherwise.
+func (c *Counterparty) Key() string {
+	if c.AccountNumber != "" {
+		return "account:" + c.AccountNumber + "/" + strings.ToLower(c.Bank)
+	}
+	return "name:" + strings.ToLower(c.Name)
+}
+
+// counterpartyRelationship is the relationship from a transaction to its counterparty.
+func (t *Transaction) counterpartyRelationship() string {
+	if t.Type == -1 {
+		return "SENT_TO"
+	}
+	return "RECEIVED_FROM"
+}
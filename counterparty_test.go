@@ -0,0 +1,62 @@
+package main
+
+import "testing"
+
+func TestParseCounterparty(t *testing.T) {
+	tests := []struct {
+		party string
+		want  *Counterparty
+		key   string
+	}{
+		{
+			party: "JOHN DOE/0123456789/GTBank",
+			want:  &Counterparty{Name: "JOHN DOE", AccountNumber: "0123456789", Bank: "GTBank"},
+			key:   "account:0123456789/gtbank",
+		},
+		{
+			party: "A/B Ventures/0123456789/Access/Diamond Bank",
+			want:  &Counterparty{Name: "A/B Ventures", AccountNumber: "0123456789", Bank: "Access/Diamond Bank"},
+			key:   "account:0123456789/access/diamond bank",
+		},
+		{
+			party: "Pos Transfer-Jane   Doe/9876543210/Kuda",
+			want:  &Counterparty{Name: "Jane Doe", AccountNumber: "9876543210", Bank: "Kuda"},
+			key:   "account:9876543210/kuda",
+		},
+		{
+			party: "NETFLIX.COM",
+			want:  &Counterparty{Name: "NETFLIX.COM"},
+			key:   "name:netflix.com",
+		},
+		{
+			// too short to be an account number
+			party: "Shop/123/Lagos",
+			want:  &Counterparty{Name: "Shop/123/Lagos"},
+			key:   "name:shop/123/lagos",
+		},
+		{
+			party: "/0123456789/",
+			want:  &Counterparty{AccountNumber: "0123456789"},
+			key:   "account:0123456789/",
+		},
+		{party: "   "},
+		{party: "Transfer to - "},
+	}
+
+	for _, tt := range tests {
+		got := parseCounterparty(tt.party)
+		if tt.want == nil {
+			if got != nil {
+				t.Errorf("parseCounterparty(%q) = %+v, want nil", tt.party, got)
+			}
+			continue
+		}
+		if got == nil || *got != *tt.want {
+			t.Errorf("parseCounterparty(%q) = %+v, want %+v", tt.party, got, tt.want)
+			continue
+		}
+		if key := got.Key(); key != tt.key {
+			t.Errorf("parseCounterparty(%q).Key() = %q, want %q", tt.party, key, tt.key)
+		}
+	}
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"awesomeProject/money"
+	"bytes"
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"mime/multipart"
+	"os"
+	"strings"
+	"time"
+)
+
+// AmountConvention describes how a CSV statement tells debits and credits apart.
+type AmountConvention string
+
+const (
+	// ConventionSplit statements have separate debit and credit columns.
+	ConventionSplit AmountConvention = "split"
+	// ConventionSigned statements have a single amount column where debits are negative.
+	ConventionSigned AmountConvention = "signed"
+	// ConventionIndicator statements have a single amount column and a separate column holding DR or CR.
+	ConventionIndicator AmountConvention = "indicator"
+)
+
+// CSVColumns holds the header of the column each field is read from. Empty columns are skipped.
+type CSVColumns struct {
+	Date        string `json:"date"`
+	Description string `json:"description"`
+	Party       string `json:"party"`
+	Category    string `json:"category"`
+	Balance     string `json:"balance"`
+	// Amount is used by the signed and indicator conventions
+	Amount string `json:"amount"`
+	// Debit and Credit are used by the split convention
+	Debit  string `json:"debit"`
+	Credit string `json:"credit"`
+	// Indicator is used by the indicator convention
+	Indicator string `json:"indicator"`
+}
+
+// CSVProfile declares how to read a bank's CSV statement export.
+type CSVProfile struct {
+	Bank       string           `json:"bank"`
+	Columns    CSVColumns       `json:"columns"`
+	DateLayout string           `json:"dateLayout"`
+	Convention AmountConvention `json:"convention"`
+	// ThousandsSeparator defaults to "," and DecimalSeparator to "."
+	ThousandsSeparator string `json:"thousandsSeparator"`
+	DecimalSeparator   string `json:"decimalSeparator"`
+	// Delimiter defaults to ","
+	Delimiter string `json:"delimiter"`
+	// Timezone is the IANA name of the timezone the statement's times are in, defaults to STATEMENT_TIMEZONE.
+	Timezone string `json:"timezone"`
+	// Currency is the ISO 4217 code of amounts without a currency symbol. When empty it's inferred
+	// from the rest of the statement.
+	Currency string `json:"currency"`
+}
+
+// builtinCSVProfiles are the banks we know how to read out of the box.
+// More can be added through the file named by STATEMENT_PROFILES.
+var builtinCSVProfiles = []CSVProfile{
+	{
+		Bank: "gtbank",
+		Columns: CSVColumns{
+			Date:        "Trans. Date",
+			Description: "Remarks",
+			Debit:       "Debits",
+			Credit:      "Credits",
+			Balance:     "Balance",
+		},
+		DateLayout: "02-Jan-2006",
+		Convention: ConventionSplit,
+	},
+	{
+		Bank: "opay",
+		Columns: CSVColumns{
+			Date:        "Trans. Time",
+			Description: "Description",
+			Debit:       "Debit(₦)",
+			Credit:      "Credit(₦)",
+			Balance:     "Balance After(₦)",
+		},
+		DateLayout: "02 Jan 2006 15:04:05",
+		Convention: ConventionSplit,
+		Currency:   "NGN",
+	},
+	{
+		Bank: "moniepoint",
+		Columns: CSVColumns{
+			Date:        "Date",
+			Description: "Narration",
+			Amount:      "Amount",
+			Indicator:   "Type",
+			Balance:     "Balance",
+		},
+		DateLayout: "2006-01-02 15:04:05",
+		Convention: ConventionIndicator,
+	},
+}
+
+// loadCSVProfiles reads additional CSV profiles from a JSON file holding an array of profiles.
+func loadCSVProfiles(path string) ([]CSVProfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read csv profiles: %s", err.Error())
+	}
+
+	var profiles []CSVProfile
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("failed to decode csv profiles: %s", err.Error())
+	}
+
+	for _, p := range profiles {
+		if err := p.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return profiles, nil
+}
+
+func csvParsers(profiles []CSVProfile) []StatementParser {
+	parsers := make([]StatementParser, 0, len(profiles))
+	for _, p := range profiles {
+		parsers = append(parsers, csvParser{profile: p})
+	}
+	return parsers
+}
+
+func (p CSVProfile) validate() error {
+	if p.Bank == "" || p.Columns.Date == "" || p.DateLayout == "" {
+		return fmt.Errorf("csv profile %q: bank, date column and date layout are required", p.Bank)
+	}
+
+	if _, err := p.location(); err != nil {
+		return fmt.Errorf("csv profile %q: invalid timezone: %s", p.Bank, err.Error())
+	}
+
+	switch p.Convention {
+	case ConventionSplit:
+		if p.Columns.Debit == "" || p.Columns.Credit == "" {
+			return fmt.Errorf("csv profile %q: split convention needs debit and credit columns", p.Bank)
+		}
+	case ConventionSigned:
+		if p.Columns.Amount == "" {
+			return fmt.Errorf("csv profile %q: signed convention needs an amount column", p.Bank)
+		}
+	case ConventionIndicator:
+		if p.Columns.Amount == "" || p.Columns.Indicator == "" {
+			return fmt.Errorf("csv profile %q: indicator convention needs amount and indicator columns", p.Bank)
+		}
+	default:
+		return fmt.Errorf("csv profile %q: unknown convention %q", p.Bank, p.Convention)
+	}
+	return nil
+}
+
+// requiredColumns are the headers that must all be present for a file to match the profile.
+func (p CSVProfile) requiredColumns() []string {
+	columns := []string{p.Columns.Date}
+	switch p.Convention {
+	case ConventionSplit:
+		columns = append(columns, p.Columns.Debit, p.Columns.Credit)
+	case ConventionSigned:
+		columns = append(columns, p.Columns.Amount)
+	case ConventionIndicator:
+		columns = append(columns, p.Columns.Amount, p.Columns.Indicator)
+	}
+	return columns
+}
+
+// location is the timezone the statement's times are read in.
+func (p CSVProfile) location() (*time.Location, error) {
+	if p.Timezone == "" {
+		return statementLocation(), nil
+	}
+	return time.LoadLocation(p.Timezone)
+}
+
+func (p CSVProfile) delimiter() rune {
+	if p.Delimiter == "" {
+		return ','
+	}
+	return []rune(p.Delimiter)[0]
+}
+
+// headerIndex maps the normalized headers of the record to their position
+// if the record is the profile's header row, and returns nil otherwise.
+func (p CSVProfile) headerIndex(record []string) map[string]int {
+	index := make(map[string]int, len(record))
+	for i, cell := range record {
+		index[normalizeHeader(cell)] = i
+	}
+
+	for _, column := range p.requiredColumns() {
+		if _, ok := index[normalizeHeader(column)]; !ok {
+			return nil
+		}
+	}
+	return index
+}
+
+// parseAmount parses an amount using the profile's separators. A leading or trailing currency symbol or code
+// is dropped and amounts in parentheses are treated as negative. Empty cells are zero, anything else that
+// isn't a number is an error.
+func (p CSVProfile) parseAmount(s string) (money.Money, error) {
+	thousands, decimal := p.ThousandsSeparator, p.DecimalSeparator
+	if thousands == "" {
+		thousands = ","
+	}
+	if decimal == "" {
+		decimal = "."
+	}
+
+	s = strings.TrimSpace(s)
+	negative := strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")")
+	if negative {
+		s = s[1 : len(s)-1]
+	}
+	_, s = money.SplitCurrency(s)
+	s = strings.ReplaceAll(s, thousands, "")
+	s = strings.ReplaceAll(s, decimal, ".")
+
+	if s == "" {
+		return 0, nil
+	}
+
+	amount, err := money.Parse(s)
+	if err != nil {
+		return 0, err
+	}
+	if negative {
+		amount = -amount
+	}
+	return amount, nil
+}
+
+func (p CSVProfile) newReader(r io.Reader) *csv.Reader {
+	reader := csv.NewReader(r)
+	reader.Comma = p.delimiter()
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+	return reader
+}
+
+// csvParser reads CSV statements laid out according to a profile.
+type csvParser struct {
+	profile CSVProfile
+	// maxLineLength overrides MAX_LINE_LENGTH when set.
+	maxLineLength int
+}
+
+func (c csvParser) Name() string { return "csv-" + c.profile.Bank }
+
+func (c csvParser) Detect(header *multipart.FileHeader, head []byte) bool {
+	// the last line of head may be cut short, so each line is read on its own
+	for _, line := range bytes.Split(head, []byte("\n")) {
+		record, err := c.profile.newReader(bytes.NewReader(line)).Read()
+		if err != nil {
+			continue
+		}
+		if c.profile.headerIndex(record) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (c csvParser) Parse(file multipart.File, size int64, info *StatementInfo) iter.Seq2[ParsedRow, error] {
+	return func(yield func(ParsedRow, error) bool) {
+		loc, err := c.profile.location()
+		if err != nil {
+			yield(ParsedRow{}, fmt.Errorf("invalid timezone: %s", err.Error()))
+			return
+		}
+		limit := cmp.Or(c.maxLineLength, maxLineLength())
+		reader := c.profile.newReader(&lineLimitReader{r: file, max: limit})
+
+		var index map[string]int
+		for line := 1; ; line++ {
+			record, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if errors.Is(err, ErrLineTooLong) {
+				yield(ParsedRow{}, fmt.Errorf("%w: line %d is longer than %d bytes, raise MAX_LINE_LENGTH to import it", ErrLineTooLong, line, limit))
+				return
+			}
+			if err != nil {
+				yield(ParsedRow{}, fmt.Errorf("failed to read line %d: %s", line, err.Error()))
+				return
+			}
+
+			// statements often have a preamble before the table, so wait for the header
+			if index == nil {
+				index = c.profile.headerIndex(record)
+				if index == nil {
+					info.parseHeaderLine(strings.Join(record, " "))
+				}
+				continue
+			}
+
+			cell := func(column string) string {
+				if column == "" {
+					return ""
+				}
+				i, ok := index[normalizeHeader(column)]
+				if !ok || i >= len(record) {
+					return ""
+				}
+				return strings.TrimSpace(record[i])
+			}
+
+			if cell(c.profile.Columns.Date) == "" {
+				continue
+			}
+
+			var row ParsedRow
+			if t, err := c.transaction(cell, loc); err != nil {
+				row = rejectedRow(line, strings.Join(record, string(c.profile.delimiter())), err)
+			} else {
+				row = transactionRow(t, line)
+			}
+			if !yield(row, nil) {
+				return
+			}
+		}
+
+		if index == nil {
+			yield(ParsedRow{}, fmt.Errorf("no %s statement header found", c.profile.Bank))
+		}
+	}
+}
+
+func (c csvParser) transaction(cell func(column string) string, loc *time.Location) (*Transaction, error) {
+	p := c.profile
+
+	dateTime, err := time.ParseInLocation(p.DateLayout, cell(p.Columns.Date), loc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidDate, err.Error())
+	}
+
+	var amount money.Money
+	var debit bool
+	switch p.Convention {
+	case ConventionSplit:
+		debitAmount, err := p.parseAmount(cell(p.Columns.Debit))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidAmount, err.Error())
+		}
+		creditAmount, err := p.parseAmount(cell(p.Columns.Credit))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidAmount, err.Error())
+		}
+		// some banks print 0.00 in the column that doesn't apply, so a zero counts as empty
+		switch {
+		case debitAmount == 0 && creditAmount == 0:
+			return nil, ErrMissingAmount
+		case debitAmount != 0 && creditAmount != 0:
+			return nil, fmt.Errorf("%w: both debit (%s) and credit (%s) are set", ErrAmbiguousAmount, debitAmount, creditAmount)
+		}
+		debit = debitAmount != 0
+		amount = debitAmount + creditAmount
+	case ConventionSigned:
+		amount, err = p.parseAmount(cell(p.Columns.Amount))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidAmount, err.Error())
+		}
+		debit = amount < 0
+	case ConventionIndicator:
+		amount, err = p.parseAmount(cell(p.Columns.Amount))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidAmount, err.Error())
+		}
+		indicator := strings.ToUpper(cell(p.Columns.Indicator))
+		debit = strings.HasPrefix(indicator, "D")
+	}
+
+	if amount < 0 {
+		amount = -amount
+	}
+
+	balance, err := p.parseAmount(cell(p.Columns.Balance))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidBalance, err.Error())
+	}
+
+	t := &Transaction{
+		DateTime:    dateTime,
+		Amount:      amount,
+		Currency:    p.Currency,
+		Category:    cell(p.Columns.Category),
+		Party:       cell(p.Columns.Party),
+		Description: cell(p.Columns.Description),
+		Balance:     balance,
+	}
+	for _, column := range []string{p.Columns.Amount, p.Columns.Debit, p.Columns.Credit, p.Columns.Balance} {
+		if currency, _ := money.SplitCurrency(cell(column)); currency != "" {
+			t.Currency = currency
+			break
+		}
+	}
+	t.setType(debit)
+	return t, nil
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"awesomeProject/money"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// statementFile is an uploaded statement held in memory.
+type statementFile struct {
+	*bytes.Reader
+}
+
+func (statementFile) Close() error { return nil }
+
+func newStatementFile(s string) statementFile {
+	return statementFile{bytes.NewReader([]byte(s))}
+}
+
+// csvProfile returns the built-in profile for the bank.
+func csvProfile(t *testing.T, bank string) CSVProfile {
+	t.Helper()
+	for _, p := range builtinCSVProfiles {
+		if p.Bank == bank {
+			return p
+		}
+	}
+	t.Fatalf("no %s profile", bank)
+	return CSVProfile{}
+}
+
+func TestCSVProfileParseAmount(t *testing.T) {
+	european := CSVProfile{ThousandsSeparator: ".", DecimalSeparator: ","}
+
+	tests := []struct {
+		name    string
+		profile CSVProfile
+		cell    string
+		want    money.Money
+		err     bool
+	}{
+		{name: "plain", cell: "1,250.50", want: 125050},
+		{name: "currency symbol", cell: "₦2,500.00", want: 250000},
+		{name: "negative", cell: "-300", want: -30000},
+		{name: "parentheses", cell: "(1,000.00)", want: -100000},
+		{name: "empty", cell: "  ", want: 0},
+		{name: "european separators", profile: european, cell: "1.250,50", want: 125050},
+		{name: "currency code", cell: "2,500.00 NGN", want: 250000},
+		{name: "negative with a symbol", cell: "-₦300", want: -30000},
+		{name: "garbled", cell: "1.2.3", err: true},
+		{name: "not available", cell: "N/A", err: true},
+		{name: "letters among digits", cell: "12abc34", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.profile.parseAmount(tt.cell)
+			if (err != nil) != tt.err {
+				t.Fatalf("parseAmount(%q) error = %v, want error %v", tt.cell, err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("parseAmount(%q) = %s, want %s", tt.cell, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCSVProfileValidate(t *testing.T) {
+	base := CSVProfile{Bank: "test", Columns: CSVColumns{Date: "Date", Amount: "Amount"}, DateLayout: "2006-01-02", Convention: ConventionSigned}
+
+	tests := []struct {
+		name   string
+		change func(p *CSVProfile)
+		err    string
+	}{
+		{name: "valid", change: func(p *CSVProfile) {}},
+		{name: "no date layout", change: func(p *CSVProfile) { p.DateLayout = "" }, err: "required"},
+		{name: "bad timezone", change: func(p *CSVProfile) { p.Timezone = "Mars/Olympus" }, err: "invalid timezone"},
+		{name: "split without credit", change: func(p *CSVProfile) { p.Convention, p.Columns.Debit = ConventionSplit, "Debit" }, err: "debit and credit"},
+		{name: "indicator without column", change: func(p *CSVProfile) { p.Convention = ConventionIndicator }, err: "indicator columns"},
+		{name: "unknown convention", change: func(p *CSVProfile) { p.Convention = "both" }, err: "unknown convention"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := base
+			tt.change(&p)
+			err := p.validate()
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("validate() error = %v, want it to mention %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestCSVParse(t *testing.T) {
+	signed := CSVProfile{
+		Bank:       "signed",
+		Columns:    CSVColumns{Date: "Date", Description: "Details", Amount: "Amount", Balance: "Balance"},
+		DateLayout: "2006-01-02",
+		Convention: ConventionSigned,
+		Delimiter:  ";",
+	}
+
+	type row struct {
+		amount  money.Money
+		debit   bool
+		balance money.Money
+	}
+	tests := []struct {
+		name     string
+		profile  CSVProfile
+		csv      string
+		currency string
+		rows     []row
+		rejected []error
+	}{
+		{
+			name:    "split",
+			profile: csvProfile(t, "gtbank"),
+			csv: "Account Name,JOHN DOE\n" +
+				"Trans. Date,Remarks,Debits,Credits,Balance\n" +
+				"12-Mar-2024,Rent,,\"15,000.00\",\"27,450.00\"\n" +
+				"12-Mar-2024,Lunch,\"2,500.00\",,\"24,950.00\"\n" +
+				"13-Mar-2024,Bad,,1.2.3,\"24,950.00\"\n" +
+				"13-Mar-2024,Nothing,,0.00,\"24,950.00\"\n" +
+				"13-Mar-2024,Both,\"1.00\",\"1.00\",\"24,950.00\"\n" +
+				"13-Mar-2024,Unavailable,N/A,,\"24,950.00\"\n",
+			rows:     []row{{amount: 1500000, balance: 2745000}, {amount: 250000, debit: true, balance: 2495000}},
+			rejected: []error{ErrInvalidAmount, ErrMissingAmount, ErrAmbiguousAmount, ErrInvalidAmount},
+		},
+		{
+			name:    "indicator",
+			profile: csvProfile(t, "moniepoint"),
+			csv: "Date,Narration,Amount,Type,Balance\n" +
+				"2024-03-12 14:05:11,POS,₦500.00,DR,₦1000.00\n" +
+				"2024-03-12 15:00:00,Transfer,₦700.00,CREDIT,₦1700.00\n",
+			currency: "NGN",
+			rows:     []row{{amount: 50000, debit: true, balance: 100000}, {amount: 70000, balance: 170000}},
+		},
+		{
+			name:    "signed",
+			profile: signed,
+			csv: "Date;Details;Amount;Balance\n" +
+				"2024-03-12;Card;-25.00 USD;75.00 USD\n" +
+				"2024-03-13;Salary;100.00 USD;175.00 USD\n",
+			currency: "USD",
+			rows:     []row{{amount: 2500, debit: true, balance: 7500}, {amount: 10000, balance: 17500}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := &StatementInfo{}
+			var transactions []*Transaction
+			var rejected []error
+			for parsed, err := range (csvParser{profile: tt.profile}).Parse(newStatementFile(tt.csv), int64(len(tt.csv)), info) {
+				if err != nil {
+					t.Fatalf("Parse() error = %v", err)
+				}
+				if parsed.Rejected != nil {
+					rejected = append(rejected, parsed.Rejected.Err)
+					continue
+				}
+				transactions = append(transactions, parsed.Transaction)
+			}
+
+			if len(rejected) != len(tt.rejected) {
+				t.Fatalf("rejected = %v, want %v", rejected, tt.rejected)
+			}
+			for i, want := range tt.rejected {
+				if !errors.Is(rejected[i], want) {
+					t.Errorf("rejected line %d: %v, want %v", i, rejected[i], want)
+				}
+			}
+			if len(transactions) != len(tt.rows) {
+				t.Fatalf("Parse() = %d transactions, want %d", len(transactions), len(tt.rows))
+			}
+			for i, want := range tt.rows {
+				got := transactions[i]
+				if got.Amount != want.amount || (got.Type == -1) != want.debit || got.Balance != want.balance || got.Currency != tt.currency {
+					t.Errorf("row %d = %s %s debit %v balance %s, want %s %s debit %v balance %s",
+						i, got.Currency, got.Amount, got.Type == -1, got.Balance, tt.currency, want.amount, want.debit, want.balance)
+				}
+			}
+		})
+	}
+}
+
+func TestCSVParseWithoutHeader(t *testing.T) {
+	csv := "Date,Amount\n2024-03-12,100\n"
+	for _, err := range (csvParser{profile: csvProfile(t, "gtbank")}).Parse(newStatementFile(csv), int64(len(csv)), &StatementInfo{}) {
+		if err == nil || !strings.Contains(err.Error(), "no gtbank statement header") {
+			t.Fatalf("Parse() error = %v, want a missing header error", err)
+		}
+		return
+	}
+	t.Fatal("Parse() yielded nothing, want a missing header error")
+}
+
+func TestCSVParseLineTooLong(t *testing.T) {
+	csv := "Trans. Date,Remarks,Debits,Credits,Balance\n" +
+		"12-Mar-2024,Rent,,15000.00,27450.00\n" +
+		"12-Mar-2024," + strings.Repeat("x", 200) + ",2500.00,,24950.00\n"
+	parser := csvParser{profile: csvProfile(t, "gtbank"), maxLineLength: 100}
+
+	rows := 0
+	for row, err := range parser.Parse(newStatementFile(csv), int64(len(csv)), &StatementInfo{}) {
+		if err != nil {
+			if !errors.Is(err, ErrLineTooLong) {
+				t.Fatalf("Parse() error = %v, want %v", err, ErrLineTooLong)
+			}
+			if rows != 1 {
+				t.Errorf("Parse() yielded %d rows before the long line, want 1", rows)
+			}
+			return
+		}
+		if row.Transaction != nil {
+			rows++
+		}
+	}
+	t.Fatalf("Parse() read the long line, want %v", ErrLineTooLong)
+}
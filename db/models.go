@@ -1,6 +1,7 @@
 package db
 
 import (
+	"awesomeProject/money"
 	"time"
 
 	"github.com/google/uuid"
@@ -38,3 +39,103 @@ type Conversation struct {
 	BaseModel
 	Messages []Message `json:"messages"`
 }
+
+// Import is the stored report of a statement upload.
+type Import struct {
+	BaseModel
+	Filename      string         `json:"filename"`
+	Parser        string         `json:"parser"`
+	Parsed        int            `json:"parsed"`
+	Categorized   int            `json:"categorized"`
+	Saved         int            `json:"saved"`
+	Duplicates    int            `json:"duplicates"`
+	Queued        int            `json:"queued"`
+	Failed        int            `json:"failed"`
+	BalanceGaps   int            `json:"balanceGaps"`
+	StatementId   string         `json:"statementId"`
+	Balanced      bool           `json:"balanced"`
+	Error         string         `json:"error"`
+	RejectedLines []RejectedLine `json:"rejectedLines"`
+}
+
+// RejectedLine is a statement line that failed to import, and why.
+type RejectedLine struct {
+	BaseModel
+	Line     int       `json:"line"`
+	Raw      string    `json:"raw"`
+	Reason   string    `json:"reason"`
+	ImportId uuid.UUID `json:"importId"`
+	Import   Import    `json:"-"`
+}
+
+// CategoryRule assigns a category to matching transactions without asking the model.
+// Every condition that's set must match, and rules with a higher priority are tried first.
+type CategoryRule struct {
+	BaseModel
+	Name     string `json:"name"`
+	Category string `json:"category"`
+	// PartyPattern and DescriptionPattern are case-insensitive regular expressions
+	PartyPattern       string `json:"partyPattern"`
+	DescriptionPattern string `json:"descriptionPattern"`
+	// MinAmount and MaxAmount are inclusive bounds, in the minor unit of the currency
+	MinAmount *money.Money `json:"minAmount"`
+	MaxAmount *money.Money `json:"maxAmount"`
+	Currency  string       `json:"currency"`
+	// Direction is "debit" or "credit", or empty for both
+	Direction string `json:"direction"`
+	Priority  int    `json:"priority"`
+}
+
+// CategoryCorrection records a transaction the user moved to another category by hand.
+type CategoryCorrection struct {
+	BaseModel
+	// Fingerprint identifies the corrected transaction in the graph
+	Fingerprint string `json:"fingerprint"`
+	// Transaction is the transaction as the categorizer saw it, so it can be shown to the model as an example
+	Transaction string `json:"transaction"`
+	From        string `json:"from"`
+	To          string `json:"to"`
+}
+
+// CategoryRetry is a saved transaction the model couldn't categorize at upload. It's filed under UNKNOWN
+// and the model is asked again once NextAttemptAt has passed.
+type CategoryRetry struct {
+	BaseModel
+	// Fingerprint identifies the transaction in the graph
+	Fingerprint string `json:"fingerprint" gorm:"uniqueIndex"`
+	// Transaction is the transaction as the categorizer saw it, so it can be asked about again
+	Transaction   string    `json:"transaction"`
+	Attempts      int       `json:"attempts"`
+	LastError     string    `json:"lastError"`
+	NextAttemptAt time.Time `json:"nextAttemptAt"`
+}
+
+// Profile is what the categorizer is told about the account holder. There's only ever one.
+type Profile struct {
+	BaseModel
+	Name     string          `json:"name"`
+	Location string          `json:"location"`
+	People   []ProfilePerson `json:"people"`
+	Vendors  []ProfileVendor `json:"vendors"`
+}
+
+// ProfilePerson is someone the account holder sends money to or gets money from.
+type ProfilePerson struct {
+	BaseModel
+	Name string `json:"name"`
+	// Relationship is who they are to the account holder, e.g. "sister" or "landlord"
+	Relationship string `json:"relationship"`
+	// Category is where transfers to or from them usually belong, if anywhere
+	Category  string    `json:"category"`
+	Notes     string    `json:"notes"`
+	ProfileId uuid.UUID `json:"-"`
+}
+
+// ProfileVendor is a business or trader the account holder buys from.
+type ProfileVendor struct {
+	BaseModel
+	Name      string    `json:"name"`
+	Category  string    `json:"category"`
+	Notes     string    `json:"notes"`
+	ProfileId uuid.UUID `json:"-"`
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"awesomeProject/graph"
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// bankChargesCategory is the category every detected fee is saved under, without asking the model.
+const bankChargesCategory = "Bank Charges"
+
+// feePatterns match the whole of the narrations Kuda gives the fees, levies and taxes it debits.
+// Only the description is checked, and only against the narration as a whole, so a transfer to
+// "Card Services Ltd" or one whose narration mentions VAT isn't mistaken for a fee.
+var feePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)^(nip )?transfer (fee|charge)s?$`),
+	regexp.MustCompile(`(?i)^(electronic money transfer levy|emtl)$`),
+	regexp.MustCompile(`(?i)^stamp duty( charge)?$`),
+	regexp.MustCompile(`(?i)^(vat|value added tax)( on (nip )?transfer (fee|charge)s?)?$`),
+	regexp.MustCompile(`(?i)^sms (alert )?(fee|charge)s?$`),
+	regexp.MustCompile(`(?i)^(card|account) (maintenance|issuance) (fee|charge)s?$`),
+}
+
+// feeWindow is how far apart a fee and the transfer it was charged for can be.
+const feeWindow = 2 * time.Minute
+
+func isFee(t *Transaction) bool {
+	if t.Type != -1 {
+		return false
+	}
+	description := strings.Join(strings.Fields(t.Description), " ")
+	for _, p := range feePatterns {
+		if p.MatchString(description) {
+			return true
+		}
+	}
+	return false
+}
+
+// linkFee links a saved fee to the transfer it was charged for: the closest saved non-fee debit in time.
+// Fees with nothing within feeWindow, such as monthly maintenance charges, are left unlinked.
+func linkFee(fee *Transaction) error {
+	graphConn, err := graph.NewGraphConn()
+	if err != nil {
+		return fmt.Errorf("failed to connect to graph database: %s", err.Error())
+	}
+	defer graphConn.Close()
+
+	_, err = graphConn.Execute(
+		context.Background(),
+		`
+		MATCH (f:Transaction {fingerprint: $fee})
+		WHERE NOT (f)-[:FEE_FOR]->()
+		MATCH (t:Transaction {type: "Debit", currency: f.currency})
+		WHERE t <> f AND t.dateTime >= f.dateTime - duration($window) AND t.dateTime <= f.dateTime + duration($window)
+			AND NOT (t)-[:BELONGS_TO]->(:Category {name: $bankCharges})
+		WITH f, t ORDER BY abs(duration.inSeconds(t.dateTime, f.dateTime).seconds) LIMIT 1
+		MERGE (f)-[:FEE_FOR]->(t)`,
+		map[string]interface{}{
+			"fee":         fee.Fingerprint(),
+			"window":      fmt.Sprintf("PT%dS", int(feeWindow.Seconds())),
+			"bankCharges": bankChargesCategory,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to execute query: %s", err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestIsFee(t *testing.T) {
+	tests := []struct {
+		name        string
+		debit       bool
+		party       string
+		description string
+		want        bool
+	}{
+		{name: "transfer fee", debit: true, party: "Kuda", description: "Transfer fee", want: true},
+		{name: "levy", debit: true, party: "Kuda", description: "Electronic Money Transfer Levy", want: true},
+		{name: "stamp duty", debit: true, party: "Kuda", description: "STAMP DUTY", want: true},
+		{name: "vat on a fee", debit: true, party: "Kuda", description: "VAT on  transfer fee", want: true},
+		{name: "sms alerts", debit: true, party: "Kuda", description: "SMS Alert Charges", want: true},
+		{name: "card maintenance", debit: true, party: "Kuda", description: "Card Maintenance Fee", want: true},
+		{name: "credit", party: "Kuda", description: "Transfer fee"},
+		{name: "business named like a fee", debit: true, party: "Prime Card Services/0123456789/Access", description: "card fee refund"},
+		{name: "narration mentioning vat", debit: true, party: "JOHN DOE/0123456789/GTBank", description: "invoice 42 incl. VAT"},
+		{name: "party mentioning a charge", debit: true, party: "Bank Charges Ltd", description: "consulting"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := &Transaction{Party: tt.party, Description: tt.description}
+			tr.setType(tt.debit)
+			if got := isFee(tr); got != tt.want {
+				t.Errorf("isFee(%q, %q) = %v, want %v", tt.party, tt.description, got, tt.want)
+			}
+		})
+	}
+}
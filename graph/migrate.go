@@ -0,0 +1,46 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// Migration is a one-off change to data already stored in the graph.
+// It runs Query, or Run for changes that can't be expressed in Cypher alone.
+type Migration struct {
+	Name  string
+	Query string
+	Run   func(ctx context.Context, g *Conn) error
+}
+
+// Migrate runs the migrations that haven't been applied yet, in order.
+// Applied migrations are recorded as (:Migration {name}) nodes so each runs exactly once.
+func (g *Conn) Migrate(ctx context.Context, migrations []Migration) error {
+	for _, m := range migrations {
+		res, err := g.Execute(ctx, `MATCH (m:Migration {name: $name}) RETURN m`, map[string]interface{}{"name": m.Name})
+		if err != nil {
+			return fmt.Errorf("failed to check migration %s: %s", m.Name, err.Error())
+		}
+		if len(res.Records) > 0 {
+			continue
+		}
+
+		if m.Run != nil {
+			err = m.Run(ctx, g)
+		} else {
+			_, err = g.Execute(ctx, m.Query, map[string]interface{}{})
+		}
+		if err != nil {
+			return fmt.Errorf("failed to run migration %s: %s", m.Name, err.Error())
+		}
+
+		_, err = g.Execute(ctx, `CREATE (m:Migration {name: $name, appliedAt: datetime()})`, map[string]interface{}{"name": m.Name})
+		if err != nil {
+			return fmt.Errorf("failed to record migration %s: %s", m.Name, err.Error())
+		}
+
+		slog.Info("applied graph migration", "name", m.Name)
+	}
+	return nil
+}
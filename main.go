@@ -8,7 +8,6 @@ import (
 	"embed"
 	"errors"
 	"fmt"
-	"io"
 	"io/fs"
 	"log"
 	"log/slog"
@@ -16,9 +15,9 @@ import (
 	"os"
 	"strings"
 	"time"
+	_ "time/tzdata" // the runtime image has no zoneinfo for STATEMENT_TIMEZONE
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/generative-ai-go/genai"
 	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
 	"gorm.io/gorm"
 )
@@ -39,7 +38,7 @@ func init() {
 }
 
 func main() {
-	model := ai.New()
+	model := ai.New(statementLocation().String())
 	conn, err := graph.NewGraphConn()
 	if err != nil {
 		slog.Debug("error connecting to neo4j")
@@ -47,13 +46,33 @@ func main() {
 	}
 	defer conn.Close()
 
+	err = conn.Migrate(context.Background(), graphMigrations)
+	if err != nil {
+		slog.Error("error migrating graph", "error", err.Error())
+	}
+
 	sqlite := db.New()
 
-	err = sqlite.AutoMigrate(&db.Conversation{}, &db.Message{})
+	err = sqlite.AutoMigrate(&db.Conversation{}, &db.Message{}, &db.Import{}, &db.RejectedLine{}, &db.CategoryRule{}, &db.Profile{}, &db.ProfilePerson{}, &db.ProfileVendor{}, &db.CategoryCorrection{}, &db.CategoryRetry{})
 	if err != nil {
 		slog.Error("error migrating database", "error", err.Error())
 	}
 
+	// transactions the model couldn't categorize at upload are asked about again in the background
+	if model != nil {
+		go retryCategories(context.Background(), model, sqlite)
+	}
+
+	if path := os.Getenv("STATEMENT_PROFILES"); path != "" {
+		profiles, err := loadCSVProfiles(path)
+		if err != nil {
+			slog.Error("error loading statement profiles", "error", err.Error())
+		}
+		for _, p := range csvParsers(profiles) {
+			RegisterParser(p)
+		}
+	}
+
 	r := gin.Default()
 
 	distFs, err := fs.Sub(embeddedFiles, "frontend/dist")
@@ -103,9 +122,6 @@ func main() {
 		c.JSON(200, gin.H{"information": output})
 	})
 
-	aimodel := model.GenerativeModel("gemini-2.0-pro-exp")
-	cs := aimodel.StartChat()
-
 	api := r.Group("/api")
 
 	api.GET("/health", func(c *gin.Context) {
@@ -150,37 +166,420 @@ func main() {
 		statementFile, err := statementDocs[0].Open()
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"status": 500, "error": "failed to open file"})
+			return
+		}
+
+		strictness, err := balanceStrictness(c.PostForm("balanceCheck"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": 400, "error": err.Error()})
+			return
+		}
+
+		stream, err := parseStatement(statementFile, statementDocs[0])
+		if err != nil {
+			slog.Error("error parsing statement", "error", err.Error())
+			c.JSON(http.StatusBadRequest, gin.H{"status": 400, "error": "failed to parse statement"})
+			return
+		}
+
+		categorizer, err := newCategorizer(model, sqlite)
+		if err != nil {
+			slog.Error("error loading category rules", "error", err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"status": 500, "error": "failed to load category rules"})
+			return
+		}
+
+		report := &ImportReport{Filename: statementDocs[0].Filename, Parser: stream.Parser}
+
+		// nothing may be saved from a statement that fails the strict check, so it's read in full before importing
+		if strictness == BalanceStrict {
+			result, err := collectRows(stream.Rows)
+			if err != nil {
+				slog.Error("error parsing statement", "error", err.Error())
+				c.JSON(http.StatusBadRequest, gin.H{"status": 400, "error": err.Error()})
+				return
+			}
+
+			report.BalanceGaps = validateBalances(result.Transactions)
+			if len(report.BalanceGaps) > 0 {
+				report.Parsed = len(result.Transactions)
+				if err := sqlite.Create(report.record()).Error; err != nil {
+					slog.Error("error saving import report", "error", err.Error())
+				}
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"status": 422, "error": "statement balances don't add up", "report": report})
+				return
+			}
+			stream.Rows = result.rows()
+		}
+
+		importErr := importTransactions(categorizer, stream, strictness, report)
+
+		if err := sqlite.Create(report.record()).Error; err != nil {
+			slog.Error("error saving import report", "error", err.Error())
+		}
+
+		if importErr != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"status": 422, "error": importErr.Error(), "report": report})
+			return
 		}
 
-		transactions := parseFile(statementFile)
+		c.JSON(200, gin.H{"done": true, "report": report})
+	})
+
+	api.GET("/imports", func(c *gin.Context) {
+		var imports []db.Import
+		if err := sqlite.Order("created_at DESC").Find(&imports).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve imports"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"error": nil, "data": imports, "count": len(imports)})
+	})
 
-		var totalIn, totalOut float64
-		for _, t := range transactions {
-			if t.Type == -1 {
-				totalOut += t.Amount
+	api.GET("/imports/:id", func(c *gin.Context) {
+		var record db.Import
+		err := sqlite.Preload("RejectedLines").Where("id = ?", c.Param("id")).First(&record).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "import with id not found"})
 			} else {
-				totalIn += t.Amount
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve import"})
 			}
+			return
 		}
+		c.JSON(http.StatusOK, gin.H{"error": nil, "data": record})
+	})
 
-		fmt.Printf("Total In: %f; Total Out: %f\n", totalIn, totalOut)
+	api.GET("/statements", func(c *gin.Context) {
+		statements, err := listStatements(c.Request.Context(), conn)
+		if err != nil {
+			slog.Error("error listing statements", "error", err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve statements"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"error": nil, "data": statements, "count": len(statements)})
+	})
 
-		for _, t := range transactions {
-			category, err := model.PredictCategory(t.String())
-			if err != nil {
-				slog.Error("error: predict category error", "transaction", t.String(), "error", err)
-				continue
+	api.DELETE("/statements/:id", func(c *gin.Context) {
+		deleted, found, err := deleteStatement(c.Request.Context(), conn, c.Param("id"))
+		if err != nil {
+			slog.Error("error deleting statement", "error", err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete statement"})
+			return
+		}
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "statement with id not found"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"error": nil, "deletedTransactions": deleted})
+	})
+
+	api.PATCH("/transactions/:id/category", func(c *gin.Context) {
+		var body struct {
+			Category string `json:"category"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body: " + err.Error()})
+			return
+		}
+
+		categories, err := loadCategories(context.Background(), conn)
+		if err != nil {
+			slog.Error("error loading categories", "error", err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve categories"})
+			return
+		}
+
+		// transactions are identified by their fingerprint
+		correction, found, err := correctCategory(context.Background(), conn, sqlite, categories, c.Param("id"), body.Category)
+		if err != nil {
+			if status := categoryErrorStatus(err); status != http.StatusInternalServerError {
+				c.JSON(status, gin.H{"error": err.Error()})
+			} else {
+				slog.Error("error correcting category", "error", err.Error())
+				c.JSON(status, gin.H{"error": "failed to update category"})
 			}
-			t.Category = category
-			err = saveTransaction(t)
-			if err != nil {
-				slog.Error("error: saving category", "transaction", t.String(), "error", err)
-				continue
+			return
+		}
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "transaction with id not found"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"error": nil, "data": correction})
+	})
+
+	api.GET("/review", func(c *gin.Context) {
+		transactions, err := listReview(context.Background(), conn)
+		if err != nil {
+			slog.Error("error listing review queue", "error", err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve review queue"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"error": nil, "data": transactions, "count": len(transactions)})
+	})
+
+	api.POST("/review/:id/accept", func(c *gin.Context) {
+		found, err := acceptReview(context.Background(), conn, c.Param("id"))
+		if err != nil {
+			slog.Error("error accepting category", "error", err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to accept category"})
+			return
+		}
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "transaction with id not found"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"error": nil})
+	})
+
+	api.POST("/review/:id/override", func(c *gin.Context) {
+		var body struct {
+			Category string `json:"category"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body: " + err.Error()})
+			return
+		}
+
+		categories, err := loadCategories(context.Background(), conn)
+		if err != nil {
+			slog.Error("error loading categories", "error", err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve categories"})
+			return
+		}
+
+		correction, found, err := correctCategory(context.Background(), conn, sqlite, categories, c.Param("id"), body.Category)
+		if err != nil {
+			if status := categoryErrorStatus(err); status != http.StatusInternalServerError {
+				c.JSON(status, gin.H{"error": err.Error()})
+			} else {
+				slog.Error("error overriding category", "error", err.Error())
+				c.JSON(status, gin.H{"error": "failed to override category"})
+			}
+			return
+		}
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "transaction with id not found"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"error": nil, "data": correction})
+	})
+
+	api.GET("/retries", func(c *gin.Context) {
+		var retries []db.CategoryRetry
+		if err := sqlite.Order("next_attempt_at ASC").Find(&retries).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve retries"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"error": nil, "data": retries, "count": len(retries)})
+	})
+
+	api.POST("/retries/run", func(c *gin.Context) {
+		if model == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "retrying needs a model, set GEMINI_API_KEY or LLM_PROVIDER"})
+			return
+		}
+
+		// everything queued is due when asked for explicitly
+		if err := sqlite.Model(&db.CategoryRetry{}).Where("1 = 1").Update("next_attempt_at", time.Now()).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve retries"})
+			return
+		}
+		categorized, err := runRetries(context.Background(), model, sqlite)
+		if err != nil {
+			slog.Error("error retrying categories", "error", err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retry categories"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"error": nil, "categorized": categorized})
+	})
+
+	api.GET("/categories", func(c *gin.Context) {
+		categories, err := listCategories(context.Background(), conn)
+		if err != nil {
+			slog.Error("error listing categories", "error", err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve categories"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"error": nil, "data": categories, "count": len(categories)})
+	})
+
+	api.POST("/categories", func(c *gin.Context) {
+		var category ai.Category
+		if err := c.ShouldBindJSON(&category); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid category: " + err.Error()})
+			return
+		}
+
+		id, err := createCategory(context.Background(), conn, sqlite, category)
+		if err != nil {
+			c.JSON(categoryErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"error": nil, "data": gin.H{"id": id, "name": category.Name, "description": category.Description, "parent": category.Parent}})
+	})
+
+	api.PUT("/categories/:id", func(c *gin.Context) {
+		var category ai.Category
+		if err := c.ShouldBindJSON(&category); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid category: " + err.Error()})
+			return
+		}
+
+		found, err := updateCategory(context.Background(), conn, sqlite, c.Param("id"), category)
+		if !found && err == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "category with id not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(categoryErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"error": nil, "data": gin.H{"id": c.Param("id"), "name": category.Name, "description": category.Description, "parent": category.Parent}})
+	})
+
+	api.DELETE("/categories/:id", func(c *gin.Context) {
+		found, err := deleteCategory(context.Background(), conn, sqlite, c.Param("id"))
+		if !found && err == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "category with id not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(categoryErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"error": nil})
+	})
+
+	api.GET("/rules", func(c *gin.Context) {
+		var rules []db.CategoryRule
+		if err := sqlite.Order("priority DESC, created_at ASC").Find(&rules).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve rules"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"error": nil, "data": rules, "count": len(rules)})
+	})
+
+	api.POST("/rules", func(c *gin.Context) {
+		var rule db.CategoryRule
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid rule: " + err.Error()})
+			return
+		}
+		categories, err := loadCategories(context.Background(), conn)
+		if err != nil {
+			slog.Error("error loading categories", "error", err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve categories"})
+			return
+		}
+		compiled, err := compileRule(rule, categories)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		rule.Category = compiled.Category
+
+		if err := sqlite.Create(&rule).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create rule"})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"error": nil, "data": rule})
+	})
+
+	api.PUT("/rules/:id", func(c *gin.Context) {
+		var rule db.CategoryRule
+		err := sqlite.Where("id = ?", c.Param("id")).First(&rule).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "rule with id not found"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve rule"})
 			}
-			time.Sleep(time.Millisecond * 1000)
+			return
 		}
 
-		c.JSON(200, gin.H{"done": true})
+		var update db.CategoryRule
+		if err := c.ShouldBindJSON(&update); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid rule: " + err.Error()})
+			return
+		}
+		update.BaseModel = rule.BaseModel
+		categories, err := loadCategories(context.Background(), conn)
+		if err != nil {
+			slog.Error("error loading categories", "error", err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve categories"})
+			return
+		}
+		compiled, err := compileRule(update, categories)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		update.Category = compiled.Category
+
+		if err := sqlite.Save(&update).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update rule"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"error": nil, "data": update})
+	})
+
+	api.DELETE("/rules/:id", func(c *gin.Context) {
+		res := sqlite.Where("id = ?", c.Param("id")).Delete(&db.CategoryRule{})
+		if res.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete rule"})
+			return
+		}
+		if res.RowsAffected == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "rule with id not found"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"error": nil})
+	})
+
+	api.GET("/profile", func(c *gin.Context) {
+		profile, err := loadProfile(sqlite)
+		if err != nil {
+			slog.Error("error loading profile", "error", err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve profile"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"error": nil, "data": profile})
+	})
+
+	api.PUT("/profile", func(c *gin.Context) {
+		var profile db.Profile
+		if err := c.ShouldBindJSON(&profile); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid profile: " + err.Error()})
+			return
+		}
+		categories, err := loadCategories(context.Background(), conn)
+		if err != nil {
+			slog.Error("error loading categories", "error", err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve categories"})
+			return
+		}
+		if err := validateProfile(&profile, categories); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		saved, err := saveProfile(sqlite, profile)
+		if err != nil {
+			slog.Error("error saving profile", "error", err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save profile"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"error": nil, "data": saved})
+	})
+
+	api.DELETE("/profile", func(c *gin.Context) {
+		saved, err := saveProfile(sqlite, db.Profile{})
+		if err != nil {
+			slog.Error("error clearing profile", "error", err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to clear profile"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"error": nil, "data": saved})
 	})
 
 	api.POST("/chat/new", func(c *gin.Context) {
@@ -218,7 +617,25 @@ func main() {
 			return
 		}
 
-		cypher, err := model.GenerateCypher(query)
+		if model == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"response": nil,
+				"error":    "chat needs a model, set GEMINI_API_KEY or LLM_PROVIDER",
+			})
+			return
+		}
+
+		categories, err := loadCategories(context.Background(), conn)
+		if err != nil {
+			slog.Error("error loading categories", "error", err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"response": nil,
+				"error":    "failed to retrieve categories",
+			})
+			return
+		}
+
+		cypher, err := model.GenerateCypher(categories, query)
 		if err != nil {
 			slog.Error("error generating cypher", "error", err.Error())
 			c.JSON(http.StatusInternalServerError, gin.H{
@@ -241,29 +658,27 @@ func main() {
 			return
 		}
 
-		response := model.Respond(query, res.Records, conversation.Messages, cs)
-
-		c.Stream(func(w io.Writer) bool {
-			r, err := response.Next()
+		var newMessage strings.Builder
+		for chunk, err := range model.Respond(query, res.Records, conversation.Messages) {
 			if err != nil {
-				c.SSEvent("end", "close connection")
 				slog.Error("error streaming ai response", "error", err.Error())
-				return false
+				break
 			}
-			data := fmt.Sprintf(`"%s"`, r.Candidates[0].Content.Parts[0])
+			newMessage.WriteString(chunk)
+			data := fmt.Sprintf(`"%s"`, chunk)
 			slog.Info(data)
 			c.SSEvent("message", data)
-			return true
-		})
+			c.Writer.Flush()
+		}
+		c.SSEvent("end", "close connection")
 
-		newMessage := string(response.MergedResponse().Candidates[0].Content.Parts[0].(genai.Text))
 		err = sqlite.Transaction(func(tx *gorm.DB) error {
 			err := tx.Create(&db.Message{Content: query, Role: db.ROLEUSER, ConversationId: conversation.ID}).Error
 			if err != nil {
 				return err
 			}
 
-			err = tx.Create(&db.Message{Content: newMessage, Role: db.ROLEBOT, ConversationId: conversation.ID}).Error
+			err = tx.Create(&db.Message{Content: newMessage.String(), Role: db.ROLEBOT, ConversationId: conversation.ID}).Error
 			if err != nil {
 				return err
 			}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"awesomeProject/ai"
+	"awesomeProject/graph"
+	"awesomeProject/money"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// graphMigrations are applied in order when the server starts. Never edit or reorder one that has shipped,
+// add a new one instead.
+var graphMigrations = []graph.Migration{
+	{
+		// amounts used to be stored as naira in Doubles, they're now whole kobo
+		Name: "0001_money_to_kobo",
+		Query: `
+		MATCH (t:Transaction)
+		WHERE t.amount IS :: FLOAT OR t.balance IS :: FLOAT
+		SET t.amount = CASE WHEN t.amount IS :: FLOAT THEN toInteger(round(t.amount * 100)) ELSE t.amount END,
+			t.balance = CASE WHEN t.balance IS :: FLOAT THEN toInteger(round(t.balance * 100)) ELSE t.balance END`,
+	},
+	{
+		Name: "0002_transaction_fingerprints",
+		Run:  backfillFingerprints,
+	},
+	{
+		Name:  "0003_transaction_fingerprint_unique",
+		Query: `CREATE CONSTRAINT transaction_fingerprint IF NOT EXISTS FOR (t:Transaction) REQUIRE t.fingerprint IS UNIQUE`,
+	},
+	{
+		// everything imported before currencies were tracked came from naira accounts
+		Name:  "0004_transaction_currency",
+		Query: `MATCH (t:Transaction) WHERE t.currency IS NULL SET t.currency = "NGN"`,
+	},
+	{
+		Name: "0005_transaction_timezone",
+		Run:  correctTimezones,
+	},
+	{
+		Name:  "0006_counterparty_key_unique",
+		Query: `CREATE CONSTRAINT counterparty_key IF NOT EXISTS FOR (p:Counterparty) REQUIRE p.key IS UNIQUE`,
+	},
+	{
+		Name: "0007_counterparties",
+		Run:  backfillCounterparties,
+	},
+	{
+		Name:  "0008_statement_key_unique",
+		Query: `CREATE CONSTRAINT statement_key IF NOT EXISTS FOR (s:Statement) REQUIRE s.key IS UNIQUE`,
+	},
+	{
+		Name: "0009_normalize_categories",
+		Run:  normalizeCategories,
+	},
+	{
+		Name: "0010_dedupe_categories",
+		Run:  dedupeCategories,
+	},
+	{
+		Name:  "0011_category_name_unique",
+		Query: `CREATE CONSTRAINT category_name IF NOT EXISTS FOR (c:Category) REQUIRE c.name IS UNIQUE`,
+	},
+	{
+		Name: "0012_seed_categories",
+		Run:  seedCategories,
+	},
+}
+
+// normalizeCategories merges the Category nodes created from model answers that weren't in the category list
+// into the category they meant. Transactions in categories that can't be mapped are moved to UNKNOWN,
+// keeping the answer in rawCategory.
+func normalizeCategories(ctx context.Context, g *graph.Conn) error {
+	res, err := g.Execute(ctx, `MATCH (c:Category) RETURN c.name AS name`, map[string]interface{}{})
+	if err != nil {
+		return err
+	}
+
+	for _, record := range res.Records {
+		name, _, err := neo4j.GetRecordValue[string](record, "name")
+		if err != nil {
+			return err
+		}
+
+		category, ok := defaultCategories.normalize(name)
+		if ok && category == name {
+			continue
+		}
+
+		params := map[string]interface{}{"name": name, "category": category, "raw": nil}
+		if !ok {
+			params["category"], params["raw"] = unknownCategory, name
+		}
+
+		_, err = g.Execute(ctx, `
+		MATCH (old:Category {name: $name})
+		MERGE (c:Category {name: $category})
+		WITH old, c
+		OPTIONAL MATCH (t:Transaction)-[r:BELONGS_TO]->(old)
+		FOREACH (_ IN CASE WHEN t IS NULL THEN [] ELSE [1] END |
+			MERGE (t)-[:BELONGS_TO]->(c)
+			SET t.rawCategory = coalesce(t.rawCategory, $raw)
+			DELETE r)
+		WITH DISTINCT old
+		DETACH DELETE old`, params)
+		if err != nil {
+			return fmt.Errorf("category %q: %s", name, err.Error())
+		}
+	}
+	return nil
+}
+
+// dedupeCategories merges Category nodes that share a name, which seeding the categories with CREATE
+// and concurrent MERGEs could leave behind, so the name can be made unique.
+func dedupeCategories(ctx context.Context, g *graph.Conn) error {
+	_, err := g.Execute(ctx, `
+	MATCH (c:Category)
+	WITH c.name AS name, collect(c) AS nodes
+	WHERE size(nodes) > 1
+	WITH head(nodes) AS keep, tail(nodes) AS extras
+	UNWIND extras AS extra
+	OPTIONAL MATCH (t:Transaction)-[r:BELONGS_TO]->(extra)
+	FOREACH (_ IN CASE WHEN t IS NULL THEN [] ELSE [1] END |
+		MERGE (t)-[:BELONGS_TO]->(keep)
+		DELETE r)
+	WITH DISTINCT extra
+	DETACH DELETE extra`, map[string]interface{}{})
+	return err
+}
+
+// seedCategories stores the default categories with their descriptions and groups, and gives every
+// category an id the API can refer to it by.
+func seedCategories(ctx context.Context, g *graph.Conn) error {
+	for _, c := range append(defaultCategories, ai.Category{Name: unknownCategory, Description: "transactions nobody could categorize"}) {
+		_, err := g.Execute(ctx, `
+		MERGE (c:Category {name: $name})
+		SET c.description = coalesce(c.description, $description)`,
+			map[string]interface{}{"name": c.Name, "description": c.Description})
+		if err != nil {
+			return fmt.Errorf("category %q: %s", c.Name, err.Error())
+		}
+	}
+
+	for _, c := range defaultCategories {
+		if c.Parent == "" {
+			continue
+		}
+		_, err := g.Execute(ctx, `
+		MATCH (c:Category {name: $name}), (p:Category {name: $parent})
+		MERGE (c)-[:CHILD_OF]->(p)`, map[string]interface{}{"name": c.Name, "parent": c.Parent})
+		if err != nil {
+			return fmt.Errorf("category %q: %s", c.Name, err.Error())
+		}
+	}
+
+	_, err := g.Execute(ctx, `
+	MATCH (c:Category)
+	WHERE c.id IS NULL
+	SET c.id = randomUUID()`, map[string]interface{}{})
+	return err
+}
+
+// backfillFingerprints fingerprints the transactions saved before uploads were deduplicated.
+// Duplicates left behind by overlapping uploads are relabelled DuplicateTransaction rather than deleted,
+// so they stop counting towards totals but can still be inspected.
+func backfillFingerprints(ctx context.Context, g *graph.Conn) error {
+	res, err := g.Execute(ctx, `
+	MATCH (t:Transaction)
+	WHERE t.fingerprint IS NULL
+	RETURN elementId(t) AS id, t.dateTime AS dateTime, t.amount AS amount, t.type AS type,
+		t.balance AS balance, coalesce(t.party, "") AS party, coalesce(t.description, "") AS description
+	ORDER BY t.dateTime`, map[string]interface{}{})
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool)
+	for _, record := range res.Records {
+		id, _, err := neo4j.GetRecordValue[string](record, "id")
+		if err != nil {
+			return err
+		}
+
+		t, err := transactionFromRecord(record)
+		if err != nil {
+			return fmt.Errorf("transaction %s: %s", id, err.Error())
+		}
+
+		fingerprint := t.Fingerprint()
+		query := `MATCH (t) WHERE elementId(t) = $id SET t.fingerprint = $fingerprint`
+		if seen[fingerprint] {
+			query = `MATCH (t) WHERE elementId(t) = $id REMOVE t:Transaction SET t:DuplicateTransaction, t.fingerprint = $fingerprint`
+		}
+		seen[fingerprint] = true
+
+		_, err = g.Execute(ctx, query, map[string]interface{}{"id": id, "fingerprint": fingerprint})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// correctTimezones fixes transactions saved before statement times were parsed in STATEMENT_TIMEZONE.
+// Their wall-clock time is right but it was labelled UTC, so it's re-read in the statement timezone,
+// and the fingerprint is recomputed since the instant it's based on has moved.
+func correctTimezones(ctx context.Context, g *graph.Conn) error {
+	res, err := g.Execute(ctx, `
+	MATCH (t:Transaction)
+	WHERE t.dateTime.timezone IN ["UTC", "Z", "+00:00"]
+	RETURN elementId(t) AS id, t.dateTime AS dateTime, t.amount AS amount, t.type AS type, t.balance AS balance,
+		coalesce(t.party, "") AS party, coalesce(t.description, "") AS description, coalesce(t.currency, "NGN") AS currency`,
+		map[string]interface{}{})
+	if err != nil {
+		return err
+	}
+
+	loc := statementLocation()
+	for _, record := range res.Records {
+		id, _, err := neo4j.GetRecordValue[string](record, "id")
+		if err != nil {
+			return err
+		}
+
+		t, err := transactionFromRecord(record)
+		if err != nil {
+			return fmt.Errorf("transaction %s: %s", id, err.Error())
+		}
+
+		d := t.DateTime
+		t.DateTime = time.Date(d.Year(), d.Month(), d.Day(), d.Hour(), d.Minute(), d.Second(), d.Nanosecond(), loc)
+
+		_, err = g.Execute(ctx,
+			`MATCH (t) WHERE elementId(t) = $id SET t.dateTime = $dateTime, t.fingerprint = $fingerprint`,
+			map[string]interface{}{"id": id, "dateTime": t.DateTime, "fingerprint": t.Fingerprint()},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillCounterparties links the transactions saved before counterparties were parsed to their Counterparty nodes.
+func backfillCounterparties(ctx context.Context, g *graph.Conn) error {
+	res, err := g.Execute(ctx, `
+	MATCH (t:Transaction)
+	WHERE t.party IS NOT NULL AND t.party <> "" AND NOT (t)-[:SENT_TO|RECEIVED_FROM]->(:Counterparty)
+	RETURN elementId(t) AS id, t.party AS party, t.type AS type`, map[string]interface{}{})
+	if err != nil {
+		return err
+	}
+
+	for _, record := range res.Records {
+		id, _, err := neo4j.GetRecordValue[string](record, "id")
+		if err != nil {
+			return err
+		}
+		party, _, err := neo4j.GetRecordValue[string](record, "party")
+		if err != nil {
+			return err
+		}
+		transactionType, _, err := neo4j.GetRecordValue[string](record, "type")
+		if err != nil {
+			return err
+		}
+
+		counterparty := parseCounterparty(party)
+		if counterparty == nil {
+			continue
+		}
+
+		t := &Transaction{}
+		t.setType(transactionType == "Debit")
+		_, err = g.Execute(ctx, `
+		MATCH (t) WHERE elementId(t) = $id
+		MERGE (p:Counterparty {key: $key})
+		ON CREATE SET p.name = $name, p.accountNumber = $accountNumber, p.bank = $bank
+		MERGE (t)-[:`+t.counterpartyRelationship()+`]->(p)`,
+			map[string]interface{}{
+				"id":            id,
+				"key":           counterparty.Key(),
+				"name":          counterparty.Name,
+				"accountNumber": counterparty.AccountNumber,
+				"bank":          counterparty.Bank,
+			})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// transactionFromRecord reads a transaction back from a record with dateTime, amount, type,
+// balance, party and description columns, and optionally a currency column.
+func transactionFromRecord(record *neo4j.Record) (*Transaction, error) {
+	dateTime, _, err := neo4j.GetRecordValue[time.Time](record, "dateTime")
+	if err != nil {
+		return nil, err
+	}
+	amount, _, err := neo4j.GetRecordValue[int64](record, "amount")
+	if err != nil {
+		return nil, err
+	}
+	balance, _, err := neo4j.GetRecordValue[int64](record, "balance")
+	if err != nil {
+		return nil, err
+	}
+	transactionType, _, err := neo4j.GetRecordValue[string](record, "type")
+	if err != nil {
+		return nil, err
+	}
+	party, _, err := neo4j.GetRecordValue[string](record, "party")
+	if err != nil {
+		return nil, err
+	}
+	description, _, err := neo4j.GetRecordValue[string](record, "description")
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Transaction{
+		DateTime:    dateTime,
+		Amount:      money.Money(amount),
+		Balance:     money.Money(balance),
+		Party:       party,
+		Description: description,
+	}
+	if currency, ok := record.Get("currency"); ok {
+		t.Currency, _ = currency.(string)
+	}
+
+	t.setType(transactionType == "Debit")
+	return t, nil
+}
@@ -0,0 +1,119 @@
+package money
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount in the minor unit of its currency, e.g. kobo for naira (100 kobo = ₦1) or cents for dollars.
+// Keeping amounts as integers means totals add up exactly, unlike float64.
+// Money carries no currency, so amounts in different currencies must never be added together.
+type Money int64
+
+// Parse reads a decimal amount such as "12500.5" or "-300" into Money without going through a float.
+// Digits beyond the second decimal place are rounded half away from zero.
+func Parse(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("empty amount")
+	}
+
+	negative := false
+	if s[0] == '-' || s[0] == '+' {
+		negative = s[0] == '-'
+		s = s[1:]
+	}
+
+	whole, fraction, _ := strings.Cut(s, ".")
+	if whole == "" && fraction == "" {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	if whole == "" {
+		whole = "0"
+	}
+	for _, r := range whole + fraction {
+		if r < '0' || r > '9' {
+			return 0, fmt.Errorf("invalid amount %q", s)
+		}
+	}
+
+	naira, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q: %s", s, err.Error())
+	}
+	if naira > (math.MaxInt64-100)/100 {
+		return 0, fmt.Errorf("invalid amount %q: out of range", s)
+	}
+
+	roundUp := len(fraction) > 2 && fraction[2] >= '5'
+	fraction = (fraction + "00")[:2]
+	kobo, _ := strconv.ParseInt(fraction, 10, 64)
+
+	m := Money(naira*100 + kobo)
+	if roundUp {
+		m++
+	}
+	if negative {
+		m = -m
+	}
+	return m, nil
+}
+
+// Kobo returns the amount in the minor unit of its currency.
+func (m Money) Kobo() int64 {
+	return int64(m)
+}
+
+// String formats the amount in the major unit with two decimal places, e.g. "12500.50".
+func (m Money) String() string {
+	sign := ""
+	if m < 0 {
+		sign = "-"
+		m = -m
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, m/100, m%100)
+}
+
+// DefaultCurrency is the ISO 4217 code assumed for amounts without a currency symbol.
+const DefaultCurrency = "NGN"
+
+// currencySymbols maps the symbols and codes found on statements to ISO 4217 codes.
+// Longer symbols come first so "US$" isn't read as "$".
+var currencySymbols = []struct {
+	symbol string
+	code   string
+}{
+	{"NGN", "NGN"},
+	{"USD", "USD"},
+	{"GBP", "GBP"},
+	{"EUR", "EUR"},
+	{"US$", "USD"},
+	{"₦", "NGN"},
+	{"$", "USD"},
+	{"£", "GBP"},
+	{"€", "EUR"},
+}
+
+// SplitCurrency separates a leading or trailing currency symbol or code from an amount,
+// e.g. "₦1,200.00" gives ("NGN", "1,200.00") and "25.00 USD" gives ("USD", "25.00").
+// The currency is empty when the amount doesn't have one.
+func SplitCurrency(s string) (currency string, amount string) {
+	s = strings.TrimSpace(s)
+
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+
+	for _, c := range currencySymbols {
+		if rest, ok := strings.CutPrefix(s, c.symbol); ok {
+			return c.code, sign + strings.TrimSpace(rest)
+		}
+		if rest, ok := strings.CutSuffix(s, c.symbol); ok {
+			return c.code, sign + strings.TrimSpace(rest)
+		}
+	}
+	return "", sign + s
+}
@@ -0,0 +1,90 @@
+package money
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Money
+		err  bool
+	}{
+		{in: "12500.5", want: 1250050},
+		{in: "-300", want: -30000},
+		{in: "+7", want: 700},
+		{in: ".5", want: 50},
+		{in: "5.", want: 500},
+		{in: " 0.01 ", want: 1},
+		{in: "1.004", want: 100},
+		{in: "1.005", want: 101},
+		{in: "0.995", want: 100},
+		{in: "-1.005", want: -101},
+		{in: "92233720368547757.99", want: math.MaxInt64 - 8},
+		{in: "92233720368547757.999", want: math.MaxInt64 - 7},
+		{in: "92233720368547758", err: true},
+		{in: "99999999999999999999", err: true},
+		{in: "", err: true},
+		{in: "-", err: true},
+		{in: ".", err: true},
+		{in: "1,000", err: true},
+		{in: "1.2.3", err: true},
+		{in: "--1", err: true},
+	}
+
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if (err != nil) != tt.err {
+			t.Errorf("Parse(%q) error = %v, want error %v", tt.in, err, tt.err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		in   Money
+		want string
+	}{
+		{in: 1250050, want: "12500.50"},
+		{in: 5, want: "0.05"},
+		{in: -30000, want: "-300.00"},
+		{in: -1, want: "-0.01"},
+		{in: 0, want: "0.00"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.in.String(); got != tt.want {
+			t.Errorf("Money(%d).String() = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSplitCurrency(t *testing.T) {
+	tests := []struct {
+		in       string
+		currency string
+		amount   string
+	}{
+		{in: "₦1,200.00", currency: "NGN", amount: "1,200.00"},
+		{in: "25.00 USD", currency: "USD", amount: "25.00"},
+		{in: "US$ 10", currency: "USD", amount: "10"},
+		{in: "$10", currency: "USD", amount: "10"},
+		{in: "-£5.50", currency: "GBP", amount: "-5.50"},
+		{in: " 3.00€ ", currency: "EUR", amount: "3.00"},
+		{in: "1,000.00", currency: "", amount: "1,000.00"},
+		{in: "-1,000.00", currency: "", amount: "-1,000.00"},
+		{in: "", currency: "", amount: ""},
+	}
+
+	for _, tt := range tests {
+		currency, amount := SplitCurrency(tt.in)
+		if currency != tt.currency || amount != tt.amount {
+			t.Errorf("SplitCurrency(%q) = (%q, %q), want (%q, %q)", tt.in, currency, amount, tt.currency, tt.amount)
+		}
+	}
+}
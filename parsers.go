@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"iter"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// StatementParser turns a bank statement in one particular format into transactions.
+type StatementParser interface {
+	// Name identifies the parser, e.g. "kuda-pdf" or "csv-gtbank".
+	Name() string
+	// Detect reports whether the parser understands the statement, given its file header
+	// and the first few kilobytes of its content.
+	Detect(header *multipart.FileHeader, head []byte) bool
+	// Parse reads the statement row by row. Metadata found above the transaction table is recorded in info
+	// as it's read, so it's there by the time the first row is yielded. Iteration stops at the first error.
+	Parse(file multipart.File, size int64, info *StatementInfo) iter.Seq2[ParsedRow, error]
+}
+
+// StatementStream is an uploaded statement being read row by row.
+type StatementStream struct {
+	Parser string
+	// Info fills in as the rows are read.
+	Info *StatementInfo
+	Rows iter.Seq2[ParsedRow, error]
+}
+
+// detectHeadSize is how much of a statement is read for format detection.
+const detectHeadSize = 4096
+
+// defaultMaxLineLength is the longest line, in bytes, the text parser accepts unless MAX_LINE_LENGTH says otherwise.
+const defaultMaxLineLength = 1 << 20
+
+// maxLineLength is the longest line the text parser accepts. It's set by MAX_LINE_LENGTH.
+var maxLineLength = sync.OnceValue(func() int {
+	s := os.Getenv("MAX_LINE_LENGTH")
+	if s == "" {
+		return defaultMaxLineLength
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 {
+		slog.Error("invalid max line length, using the default", "maxLineLength", s)
+		return defaultMaxLineLength
+	}
+	return n
+})
+
+// lineLimitReader fails with ErrLineTooLong as soon as a line runs past max bytes, so readers that buffer
+// whole lines, such as encoding/csv, can't be made to hold an unbounded one.
+type lineLimitReader struct {
+	r   io.Reader
+	max int
+	// n is how many bytes have been read since the last newline.
+	n int
+}
+
+func (l *lineLimitReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	for i, b := range p[:n] {
+		if b == '\n' {
+			l.n = 0
+			continue
+		}
+		l.n++
+		if l.n > l.max {
+			return i, ErrLineTooLong
+		}
+	}
+	return n, err
+}
+
+var (
+	parsersMu sync.RWMutex
+	// parsers are tried in order, the first one to detect the statement wins.
+	// Kuda's copy-pasted text format has no header to detect, so it's only used when nothing else matches.
+	parsers = append([]StatementParser{kudaPDFParser{}, kudaXLSXParser{}}, csvParsers(builtinCSVProfiles)...)
+)
+
+// RegisterParser adds a statement parser to the registry. It takes precedence over the
+// Kuda text fallback but not over the parsers registered before it.
+func RegisterParser(p StatementParser) {
+	parsersMu.Lock()
+	defer parsersMu.Unlock()
+	parsers = append(parsers, p)
+}
+
+// detectParser picks the parser for an uploaded statement.
+func detectParser(file multipart.File, header *multipart.FileHeader) (StatementParser, error) {
+	head := make([]byte, detectHeadSize)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, fmt.Errorf("failed to read statement: %s", err.Error())
+	}
+	head = head[:n]
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to rewind statement: %s", err.Error())
+	}
+
+	parsersMu.RLock()
+	defer parsersMu.RUnlock()
+	for _, p := range parsers {
+		if p.Detect(header, head) {
+			return p, nil
+		}
+	}
+
+	fallback := kudaTextParser{maxLineLength: maxLineLength()}
+	if fallback.Detect(header, head) {
+		return fallback, nil
+	}
+	return nil, fmt.Errorf("unrecognised statement format: %s", header.Filename)
+}
+
+// parseStatement starts reading an uploaded statement with whichever registered parser recognises it.
+func parseStatement(file multipart.File, header *multipart.FileHeader) (*StatementStream, error) {
+	parser, err := detectParser(file, header)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &StatementInfo{}
+	return &StatementStream{
+		Parser: parser.Name(),
+		Info:   info,
+		Rows:   parser.Parse(file, header.Size, info),
+	}, nil
+}
+
+func hasExt(header *multipart.FileHeader, exts ...string) bool {
+	ext := strings.ToLower(filepath.Ext(header.Filename))
+	for _, e := range exts {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+type kudaPDFParser struct{}
+
+func (kudaPDFParser) Name() string { return "kuda-pdf" }
+
+func (kudaPDFParser) Detect(header *multipart.FileHeader, head []byte) bool {
+	return hasExt(header, ".pdf") || bytes.HasPrefix(head, []byte("%PDF-"))
+}
+
+func (kudaPDFParser) Parse(file multipart.File, size int64, info *StatementInfo) iter.Seq2[ParsedRow, error] {
+	return parsePDF(file, size, info)
+}
+
+const xlsxContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+type kudaXLSXParser struct{}
+
+func (kudaXLSXParser) Name() string { return "kuda-xlsx" }
+
+func (kudaXLSXParser) Detect(header *multipart.FileHeader, head []byte) bool {
+	// xlsx workbooks are zip archives
+	return hasExt(header, ".xlsx") ||
+		header.Header.Get("Content-Type") == xlsxContentType ||
+		http.DetectContentType(head) == "application/zip"
+}
+
+func (kudaXLSXParser) Parse(file multipart.File, size int64, info *StatementInfo) iter.Seq2[ParsedRow, error] {
+	return parseXLSX(file, size, info)
+}
+
+// kudaTextLinePattern matches the start of a row in a statement copy-pasted from Kuda's PDF.
+var kudaTextLinePattern = regexp.MustCompile(`(?m)^\d{2}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}\t`)
+
+type kudaTextParser struct {
+	maxLineLength int
+}
+
+func (kudaTextParser) Name() string { return "kuda-text" }
+
+func (kudaTextParser) Detect(header *multipart.FileHeader, head []byte) bool {
+	return hasExt(header, ".txt", ".tsv") || kudaTextLinePattern.Match(head)
+}
+
+func (p kudaTextParser) Parse(file multipart.File, size int64, info *StatementInfo) iter.Seq2[ParsedRow, error] {
+	return parseFile(file, p.maxLineLength, info)
+}
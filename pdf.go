@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"iter"
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+var (
+	pdfDatePattern = regexp.MustCompile(`^\d{2}/\d{2}/\d{2}`)
+	pdfTimePattern = regexp.MustCompile(`^\d{2}:\d{2}:\d{2}$`)
+)
+
+const (
+	// pdfColumnSlack is how far (in points) text may start to the left of its column header.
+	// Amounts are right aligned, so they don't always line up with the header.
+	pdfColumnSlack = 5.0
+	// pdfMaxRowGap is the largest vertical gap (in points) between the rows of a single wrapped table cell.
+	pdfMaxRowGap = 20
+)
+
+// pdfRecord holds the cells of one transaction row, which may span several lines in the PDF
+// when the party or description wraps.
+type pdfRecord struct {
+	cells    [columnCount][]string
+	position int64
+}
+
+// cell joins the lines a cell wrapped onto. Lines are joined with a space, except where the cell wrapped
+// at a slash, so a party reads "JOHN DOE/0123456789/GTBank" the way the other formats print it and the
+// transaction gets the same fingerprint whichever format it's imported from.
+func (r *pdfRecord) cell(col int) string {
+	var b strings.Builder
+	for i, line := range r.cells[col] {
+		if i > 0 && !strings.HasSuffix(r.cells[col][i-1], "/") && !strings.HasPrefix(line, "/") {
+			b.WriteByte(' ')
+		}
+		b.WriteString(line)
+	}
+	return b.String()
+}
+
+// raw joins the cells of the record with tabs, the way they'd appear in a copy-pasted statement.
+func (r *pdfRecord) raw() string {
+	cells := make([]string, columnCount)
+	for col := range r.cells {
+		cells[col] = r.cell(col)
+	}
+	return strings.Join(cells, "\t")
+}
+
+func (r *pdfRecord) transaction() (*Transaction, error) {
+	// the time is sometimes printed on the line below the date
+	timeStr := strings.Join(r.cells[colDateTime], " ")
+	return buildTransaction(
+		timeStr,
+		r.cell(colMoneyIn),
+		r.cell(colMoneyOut),
+		r.cell(colCategory),
+		r.cell(colParty),
+		r.cell(colDescription),
+		r.cell(colBalance),
+	)
+}
+
+// parsePDF extracts the transactions from the tables of a Kuda PDF statement, a page at a time.
+// Pages without the transaction table header (e.g. the summary page) are skipped.
+// Rows are numbered in the order they appear across the whole document.
+func parsePDF(file io.ReaderAt, size int64, info *StatementInfo) iter.Seq2[ParsedRow, error] {
+	return func(yield func(ParsedRow, error) bool) {
+		reader, err := pdf.NewReader(file, size)
+		if err != nil {
+			yield(ParsedRow{}, fmt.Errorf("failed to open pdf: %s", err.Error()))
+			return
+		}
+
+		line := 0
+		for i := 1; i <= reader.NumPage(); i++ {
+			page := reader.Page(i)
+			if page.V.IsNull() {
+				continue
+			}
+
+			rows, err := page.GetTextByRow()
+			if err != nil {
+				yield(ParsedRow{}, fmt.Errorf("failed to read page %d: %s", i, err.Error()))
+				return
+			}
+
+			records, preamble := pdfRecords(rows)
+			for _, line := range preamble {
+				info.parseHeaderLine(line)
+			}
+
+			for _, record := range records {
+				line++
+				var row ParsedRow
+				if t, err := record.transaction(); err != nil {
+					row = rejectedRow(line, record.raw(), err)
+				} else {
+					row = transactionRow(t, line)
+				}
+				if !yield(row, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// pdfRecords groups the text rows of a page into transaction records, using the table header
+// to work out which column each piece of text belongs to. The rows above the table header
+// are returned as lines of text.
+func pdfRecords(rows pdf.Rows) ([]*pdfRecord, []string) {
+	var (
+		columns  []float64
+		records  []*pdfRecord
+		current  *pdfRecord
+		preamble []string
+	)
+
+	for _, row := range rows {
+		if columns == nil {
+			columns = pdfHeaderColumns(row.Content)
+			if columns == nil {
+				texts := make([]string, 0, len(row.Content))
+				for _, text := range row.Content {
+					texts = append(texts, text.S)
+				}
+				preamble = append(preamble, strings.Join(texts, " "))
+			}
+			continue
+		}
+
+		var cells [columnCount][]string
+		for _, text := range row.Content {
+			s := strings.TrimSpace(text.S)
+			if s == "" {
+				continue
+			}
+			col := pdfColumnAt(columns, text.X)
+			cells[col] = append(cells[col], s)
+		}
+
+		date := strings.Join(cells[colDateTime], " ")
+		if pdfDatePattern.MatchString(date) {
+			current = &pdfRecord{cells: cells, position: row.Position}
+			records = append(records, current)
+			continue
+		}
+
+		isContinuation := current != nil &&
+			math.Abs(float64(current.position-row.Position)) <= pdfMaxRowGap &&
+			len(cells[colMoneyIn]) == 0 && len(cells[colMoneyOut]) == 0 && len(cells[colBalance]) == 0 &&
+			(date == "" || pdfTimePattern.MatchString(date))
+		if !isContinuation {
+			// anything else (page footers, totals) ends the current record
+			current = nil
+			continue
+		}
+
+		for col := range cells {
+			current.cells[col] = append(current.cells[col], cells[col]...)
+		}
+		current.position = row.Position
+	}
+
+	return records, preamble
+}
+
+// pdfHeaderColumns returns the x position of each column if the row is the transaction table header,
+// and nil otherwise.
+func pdfHeaderColumns(texts pdf.TextHorizontal) []float64 {
+	columns := make([]float64, columnCount)
+	found := make([]bool, columnCount)
+	for _, text := range texts {
+		s := normalizeHeader(text.S)
+		if s == "" {
+			continue
+		}
+		// headers like "Money In" may be split into several pieces of text,
+		// the first piece marks the start of the column
+		for i, name := range statementColumns {
+			if !found[i] && strings.HasPrefix(normalizeHeader(name), s) {
+				columns[i] = text.X
+				found[i] = true
+				break
+			}
+		}
+	}
+
+	for _, ok := range found {
+		if !ok {
+			return nil
+		}
+	}
+	return columns
+}
+
+func pdfColumnAt(columns []float64, x float64) int {
+	col := 0
+	for i, start := range columns {
+		if x >= start-pdfColumnSlack {
+			col = i
+		}
+	}
+	return col
+}
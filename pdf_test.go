@@ -0,0 +1,131 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// pdfHeaderX is where each column of the transaction table starts on the test pages, in points.
+var pdfHeaderX = []float64{20, 100, 160, 220, 300, 400, 500}
+
+// pdfRow builds a row of text, with each piece of text placed at the given x.
+// Like the rows read from a page, its text is ordered left to right.
+func pdfRow(position int64, texts map[float64]string) *pdf.Row {
+	row := &pdf.Row{Position: position}
+	for x, s := range texts {
+		row.Content = append(row.Content, pdf.Text{X: x, S: s})
+	}
+	sort.Sort(row.Content)
+	return row
+}
+
+func pdfHeaderTexts() map[float64]string {
+	texts := make(map[float64]string, len(statementColumns))
+	for i, name := range statementColumns {
+		texts[pdfHeaderX[i]] = name
+	}
+	return texts
+}
+
+func TestPDFHeaderColumns(t *testing.T) {
+	tests := []struct {
+		name  string
+		texts map[float64]string
+		want  []float64
+	}{
+		{
+			name:  "header",
+			texts: pdfHeaderTexts(),
+			want:  pdfHeaderX,
+		},
+		{
+			name:  "headers split into words",
+			texts: map[float64]string{20: "Date/Time", 100: "Money", 125: "In", 160: "Money", 185: "Out", 220: "Category", 300: "To /", 320: "From", 400: "Description", 500: "Balance"},
+			want:  pdfHeaderX,
+		},
+		{
+			name:  "a column missing",
+			texts: map[float64]string{20: "Date/Time", 100: "Money In", 160: "Money Out", 220: "Category", 400: "Description", 500: "Balance"},
+		},
+		{
+			name:  "summary row",
+			texts: map[float64]string{20: "Opening Balance", 160: "₦10,000.00"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := pdfHeaderColumns(pdfRow(0, tt.texts).Content)
+			if len(got) != len(tt.want) {
+				t.Fatalf("pdfHeaderColumns() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("pdfHeaderColumns() column %d = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPDFColumnAt(t *testing.T) {
+	tests := []struct {
+		x    float64
+		want int
+	}{
+		{x: 0, want: colDateTime},
+		{x: 20, want: colDateTime},
+		{x: 99, want: colMoneyIn},
+		// right aligned amounts may start a little left of their header
+		{x: 96, want: colMoneyIn},
+		{x: 94, want: colDateTime},
+		{x: 450, want: colDescription},
+		{x: 600, want: colBalance},
+	}
+
+	for _, tt := range tests {
+		if got := pdfColumnAt(pdfHeaderX, tt.x); got != tt.want {
+			t.Errorf("pdfColumnAt(%v) = %d, want %d", tt.x, got, tt.want)
+		}
+	}
+}
+
+func TestPDFRecords(t *testing.T) {
+	rows := pdf.Rows{
+		pdfRow(800, map[float64]string{20: "Account Number: 2012345678"}),
+		pdfRow(760, pdfHeaderTexts()),
+		pdfRow(740, map[float64]string{20: "12/03/24", 100: "₦15,000.00", 220: "Inward Transfer", 300: "JOHN DOE/0123456789/", 400: "Rent", 500: "₦27,450.00"}),
+		// the time, the end of the party and the rest of the description wrap onto the next line
+		pdfRow(730, map[float64]string{20: "14:05:11", 300: "GTBank", 400: "contribution"}),
+		pdfRow(700, map[float64]string{20: "12/03/24 18:40:02", 160: "₦2,500.00", 220: "Outward Transfer", 300: "Mama Put Kitchen", 400: "lunch", 500: "₦24,950.00"}),
+		pdfRow(650, map[float64]string{20: "Page 1 of 3"}),
+		// too far below the footer to belong to any record
+		pdfRow(600, map[float64]string{300: "stray"}),
+	}
+
+	records, preamble := pdfRecords(rows)
+	if len(preamble) != 1 || preamble[0] != "Account Number: 2012345678" {
+		t.Errorf("pdfRecords() preamble = %q", preamble)
+	}
+	if len(records) != 2 {
+		t.Fatalf("pdfRecords() = %d records, want 2", len(records))
+	}
+
+	first, err := records[0].transaction()
+	if err != nil {
+		t.Fatalf("transaction() error = %v", err)
+	}
+	if first.Party != "JOHN DOE/0123456789/GTBank" || first.DateTime.Format(statementTimeLayout) != "12/03/24 14:05:11" {
+		t.Errorf("wrapped record = %q at %s", first.Party, first.DateTime)
+	}
+	// the same row copied from the text statement must be recognised as a duplicate
+	if text := parseKudaLines(t, kudaLines[0])[0]; first.Fingerprint() != text.Fingerprint() {
+		t.Errorf("wrapped record %q, %q doesn't match the text row %q, %q", first.Party, first.Description, text.Party, text.Description)
+	}
+	if got := records[1].raw(); !strings.HasPrefix(got, "12/03/24 18:40:02\t\t₦2,500.00\t") {
+		t.Errorf("raw() = %q", got)
+	}
+}
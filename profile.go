@@ -0,0 +1,82 @@
+package main
+
+import (
+	"awesomeProject/db"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// loadProfile reads the account holder's profile, creating an empty one the first time.
+func loadProfile(sqlite *db.DB) (db.Profile, error) {
+	var profile db.Profile
+	err := sqlite.Preload("People").Preload("Vendors").FirstOrCreate(&profile).Error
+	if err != nil {
+		return db.Profile{}, fmt.Errorf("failed to load profile: %s", err.Error())
+	}
+	return profile, nil
+}
+
+// validateProfile checks the people and vendors of a profile, and spells their categories the way the categories are.
+func validateProfile(profile *db.Profile, categories categorySet) error {
+	category := func(kind, name, c string) (string, error) {
+		if strings.TrimSpace(name) == "" {
+			return "", fmt.Errorf("every %s needs a name", kind)
+		}
+		if c == "" {
+			return "", nil
+		}
+		canonical, ok := categories.normalize(c)
+		if !ok || canonical == unknownCategory {
+			return "", fmt.Errorf("%s %q: unknown category %q", kind, name, c)
+		}
+		return canonical, nil
+	}
+
+	var err error
+	for i := range profile.People {
+		p := &profile.People[i]
+		if p.Category, err = category("person", p.Name, p.Category); err != nil {
+			return err
+		}
+	}
+	for i := range profile.Vendors {
+		v := &profile.Vendors[i]
+		if v.Category, err = category("vendor", v.Name, v.Category); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveProfile replaces the stored profile, people and vendors included, with the given one.
+func saveProfile(sqlite *db.DB, profile db.Profile) (db.Profile, error) {
+	current, err := loadProfile(sqlite)
+	if err != nil {
+		return db.Profile{}, err
+	}
+
+	err = sqlite.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("profile_id = ?", current.ID).Delete(&db.ProfilePerson{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("profile_id = ?", current.ID).Delete(&db.ProfileVendor{}).Error; err != nil {
+			return err
+		}
+
+		current.Name, current.Location = profile.Name, profile.Location
+		current.People, current.Vendors = nil, nil
+		for _, p := range profile.People {
+			current.People = append(current.People, db.ProfilePerson{Name: p.Name, Relationship: p.Relationship, Category: p.Category, Notes: p.Notes})
+		}
+		for _, v := range profile.Vendors {
+			current.Vendors = append(current.Vendors, db.ProfileVendor{Name: v.Name, Category: v.Category, Notes: v.Notes})
+		}
+		return tx.Save(&current).Error
+	})
+	if err != nil {
+		return db.Profile{}, fmt.Errorf("failed to save profile: %s", err.Error())
+	}
+	return current, nil
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"awesomeProject/db"
+	"awesomeProject/money"
+	"errors"
+	"fmt"
+	"iter"
+	"log/slog"
+)
+
+// Reasons a statement line can be rejected.
+var (
+	ErrEmptyLine      = errors.New("empty line")
+	ErrInvalidDate    = errors.New("invalid date")
+	ErrInvalidAmount  = errors.New("invalid amount")
+	ErrInvalidBalance = errors.New("invalid balance")
+	ErrFieldCount     = errors.New("wrong field count")
+	// ErrMissingAmount is returned when neither the money in nor the money out cell of a row is filled in.
+	ErrMissingAmount = errors.New("missing amount")
+	// ErrAmbiguousAmount is returned when both the money in and the money out cells of a row are filled in.
+	ErrAmbiguousAmount = errors.New("ambiguous amount")
+	// ErrCurrencyMismatch is returned when the amount and balance of a row are in different currencies.
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+	// ErrLineTooLong is returned when a line is longer than MAX_LINE_LENGTH. It stops the import at that line.
+	ErrLineTooLong = errors.New("line too long")
+)
+
+// LineError records a statement line that couldn't be imported.
+type LineError struct {
+	Line   int    `json:"line"`
+	Raw    string `json:"raw"`
+	Reason string `json:"reason"`
+	Err    error  `json:"-"`
+}
+
+// ParsedRow is a single row read from a statement: either a transaction or the reason the row was rejected.
+type ParsedRow struct {
+	Transaction *Transaction
+	Rejected    *LineError
+}
+
+func transactionRow(t *Transaction, line int) ParsedRow {
+	t.Line = line
+	return ParsedRow{Transaction: t}
+}
+
+func rejectedRow(line int, raw string, err error) ParsedRow {
+	return ParsedRow{Rejected: &LineError{Line: line, Raw: raw, Reason: err.Error(), Err: err}}
+}
+
+// ParseResult holds a whole statement read into memory, for checks that need every row before anything is saved.
+type ParseResult struct {
+	Rows         []ParsedRow
+	Transactions []*Transaction
+}
+
+// collectRows reads every row of a statement, stopping at the first error.
+func collectRows(rows iter.Seq2[ParsedRow, error]) (*ParseResult, error) {
+	result := &ParseResult{}
+	for row, err := range rows {
+		if err != nil {
+			return nil, err
+		}
+		result.Rows = append(result.Rows, row)
+		if row.Transaction != nil {
+			result.Transactions = append(result.Transactions, row.Transaction)
+		}
+	}
+	return result, nil
+}
+
+// rows yields the collected rows again, in the order they were read.
+func (r *ParseResult) rows() iter.Seq2[ParsedRow, error] {
+	return func(yield func(ParsedRow, error) bool) {
+		for _, row := range r.Rows {
+			if !yield(row, nil) {
+				return
+			}
+		}
+	}
+}
+
+// ImportReport summarises what happened to every row of an uploaded statement.
+type ImportReport struct {
+	Filename    string `json:"filename"`
+	Parser      string `json:"parser"`
+	Parsed      int    `json:"parsed"`
+	Categorized int    `json:"categorized"`
+	// RuleMatches is how many of the categorized rows were decided by a category rule rather than the model.
+	RuleMatches int `json:"ruleMatches"`
+	Saved       int `json:"saved"`
+	Duplicates  int `json:"duplicates"`
+	// Queued is how many rows the model couldn't categorize. They're saved as UNKNOWN and retried later.
+	Queued      int          `json:"queued"`
+	Fees        int          `json:"fees"`
+	Reversals   int          `json:"reversals"`
+	Failed      int          `json:"failed"`
+	Rejected    []*LineError `json:"rejected"`
+	BalanceGaps []BalanceGap `json:"balanceGaps"`
+	// Error is why the statement couldn't be read to the end. The rows before it are still imported.
+	Error string `json:"error,omitempty"`
+
+	StatementID    string         `json:"statementId"`
+	Statement      StatementInfo  `json:"statement"`
+	Reconciliation Reconciliation `json:"reconciliation"`
+	// TotalIn and TotalOut are the statement's credits and debits per currency, leaving out reversed pairs.
+	TotalIn  map[string]money.Money `json:"totalIn"`
+	TotalOut map[string]money.Money `json:"totalOut"`
+}
+
+func (r *ImportReport) fail(t *Transaction, err error) {
+	r.Failed++
+	r.Rejected = append(r.Rejected, &LineError{Line: t.Line, Raw: t.String(), Reason: err.Error(), Err: err})
+}
+
+// importTransactions categorizes and saves the rows of a statement as they're read, recording the outcome
+// of each in the report. Rows are saved before the rest of the statement is read, so a statement that can't
+// be read to the end is imported up to the failing row and the error is returned. The error is also returned
+// when the statement itself couldn't be saved, as none of its rows are then.
+func importTransactions(categorizer *Categorizer, stream *StatementStream, strictness BalanceStrictness, report *ImportReport) error {
+	var (
+		balances     balanceChecker
+		span         statementSpan
+		im           = &importer{categorizer: categorizer, report: report}
+		statementErr error
+		readErr      error
+		// the key is fixed once the header has been read, statements without an account number
+		// would get a new one on every save
+		key string
+	)
+
+	for row, err := range stream.Rows {
+		if err != nil {
+			readErr = err
+			break
+		}
+		if row.Rejected != nil {
+			report.Failed++
+			report.Rejected = append(report.Rejected, row.Rejected)
+			continue
+		}
+
+		t := row.Transaction
+		report.Parsed++
+		stream.Info.fillCurrency(t)
+		t.IsFee = isFee(t)
+		t.IsReversal = isReversal(t)
+		balances.add(t)
+		span.add(t)
+
+		// the statement's header has been read by the time its first row is, so its node is saved then
+		// and updated with the rest of its metadata at the end
+		if im.statementID == "" && statementErr == nil {
+			key = stream.Info.Key()
+			im.statementID, statementErr = saveStatement(stream.Info, key, report.Filename, Reconciliation{Balanced: true})
+			if statementErr != nil {
+				slog.Error("error: saving statement", "error", statementErr)
+			}
+		}
+		if statementErr != nil {
+			report.fail(t, fmt.Errorf("failed to save statement: %s", statementErr.Error()))
+			continue
+		}
+
+		im.add(t)
+	}
+	im.flush()
+
+	if readErr != nil {
+		slog.Error("error: reading statement", "error", readErr)
+		report.Error = readErr.Error()
+	}
+	if strictness != BalanceOff {
+		report.BalanceGaps = balances.gaps()
+	}
+
+	stream.Info.fill(span)
+	report.Statement = *stream.Info
+	report.Reconciliation = stream.Info.reconcile(span)
+	// nothing was saved without the statement, the rows have all failed
+	if statementErr != nil {
+		return errors.Join(readErr, fmt.Errorf("failed to save statement: %s", statementErr.Error()))
+	}
+
+	if key == "" {
+		key = stream.Info.Key()
+	}
+	statementID, err := saveStatement(stream.Info, key, report.Filename, report.Reconciliation)
+	if err != nil {
+		slog.Error("error: saving statement", "error", err)
+		return readErr
+	}
+	report.StatementID = statementID
+
+	for _, t := range im.fees {
+		report.Fees++
+		if err := linkFee(t); err != nil {
+			slog.Error("error: linking fee", "transaction", t.String(), "error", err)
+		}
+	}
+	for _, t := range im.reversals {
+		report.Reversals++
+		if err := linkReversal(t); err != nil {
+			slog.Error("error: linking reversal", "transaction", t.String(), "error", err)
+		}
+	}
+
+	report.TotalIn, report.TotalOut, err = statementTotals(statementID)
+	if err != nil {
+		slog.Error("error: totalling statement", "error", err)
+	}
+	return readErr
+}
+
+// importer categorizes and saves the rows of a statement once its Statement node is saved.
+type importer struct {
+	categorizer *Categorizer
+	report      *ImportReport
+	statementID string
+	// pending rows are waiting for the model, which is asked about them in batches
+	pending []*Transaction
+	// fees and reversals can come before the transaction they belong to in the statement,
+	// so they're linked once everything is saved
+	fees, reversals []*Transaction
+}
+
+// add imports a single row. Rows the model has to categorize are held back until a batch is full.
+func (im *importer) add(t *Transaction) {
+	// skip rows from earlier uploads before spending a model call on them
+	exists, err := transactionExists(t)
+	if err != nil {
+		slog.Error("error: checking for duplicate", "transaction", t.String(), "error", err)
+		im.report.fail(t, fmt.Errorf("failed to check for duplicate: %s", err.Error()))
+		return
+	}
+	if exists {
+		im.report.Duplicates++
+		if err := linkToStatement(t, im.statementID); err != nil {
+			slog.Error("error: linking duplicate to statement", "transaction", t.String(), "error", err)
+		}
+		return
+	}
+
+	if im.categorizer.categorizeLocally(t) {
+		im.save(t)
+		return
+	}
+
+	im.pending = append(im.pending, t)
+	if len(im.pending) >= categoryBatchSize {
+		im.flush()
+	}
+}
+
+// flush categorizes the rows held back for the model and saves them. Rows the model couldn't categorize
+// are saved as UNKNOWN and queued to be retried, rather than dropped.
+func (im *importer) flush() {
+	if len(im.pending) == 0 {
+		return
+	}
+
+	failed := im.categorizer.categorizeBatch(im.pending)
+	for _, t := range im.pending {
+		if err, ok := failed[t]; ok {
+			slog.Error("error: predict category error, queueing for retry", "transaction", t.String(), "error", err)
+			im.queue(t, err)
+			continue
+		}
+		im.save(t)
+	}
+	im.pending = im.pending[:0]
+}
+
+// save saves a categorized row.
+func (im *importer) save(t *Transaction) {
+	im.report.Categorized++
+	if t.Rule != "" {
+		im.report.RuleMatches++
+	}
+	im.store(t)
+}
+
+// queue saves a row the model couldn't categorize under UNKNOWN, and queues it to be asked about again.
+func (im *importer) queue(t *Transaction, err error) {
+	t.Category, t.Confidence, t.Reason = unknownCategory, 0, "waiting to be categorized again"
+	if !im.store(t) {
+		return
+	}
+	if err := im.categorizer.queueRetry(t, err); err != nil {
+		slog.Error("error: queueing category retry", "transaction", t.String(), "error", err)
+		return
+	}
+	im.report.Queued++
+}
+
+// store saves a row to the graph and reports whether it's new.
+func (im *importer) store(t *Transaction) bool {
+	created, err := saveTransaction(t, im.statementID)
+	if err != nil {
+		slog.Error("error: saving category", "transaction", t.String(), "error", err)
+		im.report.fail(t, fmt.Errorf("failed to save: %s", err.Error()))
+		return false
+	}
+	if !created {
+		im.report.Duplicates++
+		return false
+	}
+	im.report.Saved++
+
+	if t.IsFee {
+		im.fees = append(im.fees, t)
+	}
+	if t.IsReversal {
+		im.reversals = append(im.reversals, t)
+	}
+	return true
+}
+
+// record converts the report into its database model.
+func (r *ImportReport) record() *db.Import {
+	record := &db.Import{
+		Filename:    r.Filename,
+		Parser:      r.Parser,
+		Parsed:      r.Parsed,
+		Categorized: r.Categorized,
+		Saved:       r.Saved,
+		Duplicates:  r.Duplicates,
+		Queued:      r.Queued,
+		Failed:      r.Failed,
+		BalanceGaps: len(r.BalanceGaps),
+		StatementId: r.StatementID,
+		Balanced:    r.Reconciliation.Balanced,
+		Error:       r.Error,
+	}
+	for _, l := range r.Rejected {
+		record.RejectedLines = append(record.RejectedLines, db.RejectedLine{Line: l.Line, Raw: l.Raw, Reason: l.Reason})
+	}
+	return record
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"awesomeProject/ai"
+	"awesomeProject/db"
+	"awesomeProject/graph"
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// retryInterval is how often the queued transactions are checked, and the delay before the first retry.
+// Each failed retry doubles the delay, up to maxRetryDelay.
+const (
+	retryInterval = time.Minute
+	maxRetryDelay = 24 * time.Hour
+)
+
+// maxRetryAttempts is how many times a queued transaction is retried before it's left in UNKNOWN for review.
+const maxRetryAttempts = 10
+
+// queueRetry queues a saved transaction the model couldn't categorize to be asked about again.
+func (c *Categorizer) queueRetry(t *Transaction, cause error) error {
+	retry := db.CategoryRetry{
+		Fingerprint:   t.Fingerprint(),
+		Transaction:   t.String(),
+		LastError:     cause.Error(),
+		NextAttemptAt: time.Now().Add(retryInterval),
+	}
+	err := c.sqlite.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "fingerprint"}},
+		DoUpdates: clause.AssignmentColumns([]string{"transaction", "last_error", "next_attempt_at"}),
+	}).Create(&retry).Error
+	if err != nil {
+		return fmt.Errorf("failed to queue retry: %s", err.Error())
+	}
+	return nil
+}
+
+// retryCategories retries the queued transactions every retryInterval until ctx is done.
+func retryCategories(ctx context.Context, model ai.Model, sqlite *db.DB) {
+	ticker := time.NewTicker(retryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := runRetries(ctx, model, sqlite); err != nil {
+				slog.Error("error: retrying categories", "error", err)
+			}
+		}
+	}
+}
+
+// runRetries asks the model again about the queued transactions that are due, and moves the ones it answers
+// out of UNKNOWN. Transactions the user has reviewed in the meantime keep the category they were given.
+// It returns how many were categorized.
+func runRetries(ctx context.Context, model ai.Model, sqlite *db.DB) (int, error) {
+	var due []db.CategoryRetry
+	err := sqlite.Where("next_attempt_at <= ?", time.Now()).Order("next_attempt_at").Limit(categoryBatchSize).Find(&due).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to load queued transactions: %s", err.Error())
+	}
+	if len(due) == 0 {
+		return 0, nil
+	}
+
+	categorizer, err := newCategorizer(model, sqlite)
+	if err != nil {
+		return 0, err
+	}
+	if categorizer.model == nil {
+		return 0, fmt.Errorf("no model is configured")
+	}
+
+	conn, err := graph.NewGraphConn()
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to graph database: %s", err.Error())
+	}
+	defer conn.Close()
+
+	categorized := 0
+	for _, r := range due {
+		prediction, err := categorizer.model.PredictCategory(categorizer.context, r.Transaction)
+		if err != nil {
+			r.Attempts++
+			r.LastError = err.Error()
+			if r.Attempts >= maxRetryAttempts {
+				slog.Error("error: giving up on categorizing transaction", "transaction", r.Transaction, "attempts", r.Attempts, "error", err)
+				if err := sqlite.Unscoped().Delete(&r).Error; err != nil {
+					slog.Error("error: removing category retry", "transaction", r.Transaction, "error", err)
+				}
+				continue
+			}
+			r.NextAttemptAt = time.Now().Add(min(retryInterval<<r.Attempts, maxRetryDelay))
+			if err := sqlite.Save(&r).Error; err != nil {
+				slog.Error("error: rescheduling category retry", "transaction", r.Transaction, "error", err)
+			}
+			continue
+		}
+
+		t := &Transaction{}
+		categorizer.setModelCategory(t, prediction)
+		if err := setRetriedCategory(ctx, conn, r.Fingerprint, t); err != nil {
+			slog.Error("error: saving retried category", "transaction", r.Transaction, "error", err)
+			continue
+		}
+		categorized++
+		if err := sqlite.Unscoped().Delete(&r).Error; err != nil {
+			slog.Error("error: removing category retry", "transaction", r.Transaction, "error", err)
+		}
+	}
+	return categorized, nil
+}
+
+// setRetriedCategory moves a transaction out of UNKNOWN into the category the model answered with,
+// unless it has been reviewed or deleted since it was queued.
+func setRetriedCategory(ctx context.Context, conn *graph.Conn, fingerprint string, t *Transaction) error {
+	_, err := conn.Execute(ctx, `
+	MATCH (t:Transaction {fingerprint: $fingerprint})-[r:BELONGS_TO]->(:Category {name: $unknown})
+	WHERE t.reviewedAt IS NULL
+	MERGE (c:Category {name: $category})
+	ON CREATE SET c.id = randomUUID()
+	DELETE r
+	MERGE (t)-[:BELONGS_TO]->(c)
+	SET t.confidence = $confidence, t.reason = $reason, t.rawCategory = $rawCategory`,
+		map[string]interface{}{
+			"fingerprint": fingerprint,
+			"unknown":     unknownCategory,
+			"category":    t.Category,
+			"confidence":  t.Confidence,
+			"reason":      nullableString(t.Reason),
+			"rawCategory": nullableString(t.RawCategory),
+		})
+	return err
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"awesomeProject/graph"
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// reversalPattern matches the credits Kuda pays back when a transfer fails.
+var reversalPattern = regexp.MustCompile(`(?i)\b(reversal|reversed)\b`)
+
+// refundPattern matches a merchant paying a debit back. Only the description is checked, a party can be
+// named anything. Refunds are paired the same way as reversals, by amount, so only a full refund cancels
+// its debit out of the totals; a partial refund finds no debit of its amount and stays an ordinary credit.
+var refundPattern = regexp.MustCompile(`(?i)\b(refund|refunded)\b`)
+
+// reversalWindow is how long after a debit its reversal can arrive.
+const reversalWindow = 7 * 24 * time.Hour
+
+func isReversal(t *Transaction) bool {
+	return t.Type == +1 && (reversalPattern.MatchString(t.Description) || reversalPattern.MatchString(t.Party) ||
+		refundPattern.MatchString(t.Description))
+}
+
+// linkReversal links a saved reversal or refund to the debit it reverses with a REVERSED_BY relationship:
+// the latest saved debit of the same amount and currency within reversalWindow before it that hasn't
+// already been reversed. Both sides are marked reversed so they can be left out of spend and income totals.
+func linkReversal(reversal *Transaction) error {
+	graphConn, err := graph.NewGraphConn()
+	if err != nil {
+		return fmt.Errorf("failed to connect to graph database: %s", err.Error())
+	}
+	defer graphConn.Close()
+
+	_, err = graphConn.Execute(
+		context.Background(),
+		`
+		MATCH (r:Transaction {fingerprint: $reversal})
+		WHERE NOT ()-[:REVERSED_BY]->(r)
+		MATCH (t:Transaction {type: "Debit", amount: r.amount, currency: r.currency})
+		WHERE t.dateTime <= r.dateTime AND t.dateTime >= r.dateTime - duration($window)
+			AND NOT (t)-[:REVERSED_BY]->()
+		WITH r, t ORDER BY t.dateTime DESC LIMIT 1
+		MERGE (t)-[:REVERSED_BY]->(r)
+		SET t.reversed = true, r.reversed = true`,
+		map[string]interface{}{
+			"reversal": reversal.Fingerprint(),
+			"window":   fmt.Sprintf("PT%dS", int(reversalWindow.Seconds())),
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to execute query: %s", err.Error())
+	}
+	return nil
+}
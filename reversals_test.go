@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestIsReversal(t *testing.T) {
+	tests := []struct {
+		name        string
+		debit       bool
+		party       string
+		description string
+		want        bool
+	}{
+		{name: "reversal", party: "Kuda", description: "Reversal for failed transfer", want: true},
+		{name: "reversed", party: "JOHN DOE/0123456789/GTBank", description: "Transfer reversed", want: true},
+		{name: "debit", debit: true, party: "Kuda", description: "Reversal"},
+		{name: "merchant refund", party: "JUMIA", description: "Refund", want: true},
+		{name: "refunded", party: "JUMIA", description: "Order 1234 refunded", want: true},
+		{name: "merchant named refund", party: "Refund Desk Ltd", description: "payout"},
+		{name: "ordinary credit", party: "JANE DOE/9876543210/Kuda", description: "Rent"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := &Transaction{Party: tt.party, Description: tt.description}
+			tr.setType(tt.debit)
+			if got := isReversal(tr); got != tt.want {
+				t.Errorf("isReversal(%q, %q) = %v, want %v", tt.party, tt.description, got, tt.want)
+			}
+		})
+	}
+}
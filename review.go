@@ -0,0 +1,75 @@
+package main
+
+import (
+	"awesomeProject/graph"
+	"context"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// defaultReviewConfidence is the confidence below which a category is queued for review.
+const defaultReviewConfidence = 0.7
+
+// reviewConfidence is the confidence below which a category is queued for review. It's set by REVIEW_CONFIDENCE.
+var reviewConfidence = sync.OnceValue(func() float64 {
+	s := os.Getenv("REVIEW_CONFIDENCE")
+	if s == "" {
+		return defaultReviewConfidence
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f < 0 || f > 1 {
+		slog.Error("invalid review confidence, using the default", "reviewConfidence", s)
+		return defaultReviewConfidence
+	}
+	return f
+})
+
+// listReview returns the transactions waiting for review: the UNKNOWN ones and those the model wasn't
+// confident about, newest first. Transactions saved before confidences were recorded only show up if UNKNOWN.
+func listReview(ctx context.Context, conn *graph.Conn) ([]map[string]any, error) {
+	res, err := conn.Execute(ctx, `
+	MATCH (t:Transaction)-[:BELONGS_TO]->(c:Category)
+	WHERE t.reviewedAt IS NULL AND (c.name = $unknown OR t.confidence < $threshold)
+	RETURN t, c.name AS category
+	ORDER BY t.dateTime DESC`, map[string]interface{}{"unknown": unknownCategory, "threshold": reviewConfidence()})
+	if err != nil {
+		return nil, err
+	}
+
+	transactions := make([]map[string]any, 0, len(res.Records))
+	for _, record := range res.Records {
+		node, _, err := neo4j.GetRecordValue[neo4j.Node](record, "t")
+		if err != nil {
+			return nil, err
+		}
+		category, _, err := neo4j.GetRecordValue[string](record, "category")
+		if err != nil {
+			return nil, err
+		}
+
+		transaction := node.Props
+		// the fingerprint is what the review and category endpoints take as the id
+		transaction["id"] = node.Props["fingerprint"]
+		transaction["category"] = category
+		transactions = append(transactions, transaction)
+	}
+	return transactions, nil
+}
+
+// acceptReview keeps a transaction in the category it was given and takes it off the review queue.
+// It returns false if there's no such transaction.
+func acceptReview(ctx context.Context, conn *graph.Conn, fingerprint string) (bool, error) {
+	res, err := conn.Execute(ctx, `
+	MATCH (t:Transaction {fingerprint: $fingerprint})
+	SET t.reviewedAt = datetime()
+	RETURN t.fingerprint AS fingerprint`, map[string]interface{}{"fingerprint": fingerprint})
+	if err != nil {
+		return false, err
+	}
+	return len(res.Records) > 0, nil
+}
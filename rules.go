@@ -0,0 +1,104 @@
+package main
+
+import (
+	"awesomeProject/db"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// categoryRule is a CategoryRule with its patterns compiled.
+type categoryRule struct {
+	db.CategoryRule
+	party       *regexp.Regexp
+	description *regexp.Regexp
+}
+
+// compileRule validates a rule against the categories and compiles its patterns. The compiled rule's category
+// is spelt the way the category is.
+func compileRule(r db.CategoryRule, categories categorySet) (*categoryRule, error) {
+	if strings.TrimSpace(r.Category) == "" {
+		return nil, fmt.Errorf("rule %q: category is required", r.Name)
+	}
+	category, ok := categories.normalize(r.Category)
+	if !ok || category == unknownCategory {
+		return nil, fmt.Errorf("rule %q: unknown category %q", r.Name, r.Category)
+	}
+	r.Category = category
+	if r.PartyPattern == "" && r.DescriptionPattern == "" && r.MinAmount == nil && r.MaxAmount == nil && r.Direction == "" {
+		return nil, fmt.Errorf("rule %q: at least one condition is required", r.Name)
+	}
+	if r.MinAmount != nil && r.MaxAmount != nil && *r.MinAmount > *r.MaxAmount {
+		return nil, fmt.Errorf("rule %q: min amount is more than max amount", r.Name)
+	}
+
+	switch strings.ToLower(r.Direction) {
+	case "", "debit", "credit":
+	default:
+		return nil, fmt.Errorf("rule %q: unknown direction %q, expected debit or credit", r.Name, r.Direction)
+	}
+
+	rule := &categoryRule{CategoryRule: r}
+	var err error
+	if r.PartyPattern != "" {
+		if rule.party, err = regexp.Compile("(?i)" + r.PartyPattern); err != nil {
+			return nil, fmt.Errorf("rule %q: invalid party pattern: %s", r.Name, err.Error())
+		}
+	}
+	if r.DescriptionPattern != "" {
+		if rule.description, err = regexp.Compile("(?i)" + r.DescriptionPattern); err != nil {
+			return nil, fmt.Errorf("rule %q: invalid description pattern: %s", r.Name, err.Error())
+		}
+	}
+	return rule, nil
+}
+
+func (r *categoryRule) matches(t *Transaction) bool {
+	if r.Direction != "" && !strings.EqualFold(r.Direction, t.TypeString) {
+		return false
+	}
+	if r.Currency != "" && !strings.EqualFold(r.Currency, t.Currency) {
+		return false
+	}
+	if r.MinAmount != nil && t.Amount < *r.MinAmount {
+		return false
+	}
+	if r.MaxAmount != nil && t.Amount > *r.MaxAmount {
+		return false
+	}
+	if r.party != nil && !r.party.MatchString(t.Party) {
+		return false
+	}
+	if r.description != nil && !r.description.MatchString(t.Description) {
+		return false
+	}
+	return true
+}
+
+// loadRules reads the category rules in the order they're tried.
+func loadRules(sqlite *db.DB, categories categorySet) ([]*categoryRule, error) {
+	var records []db.CategoryRule
+	if err := sqlite.Order("priority DESC, created_at ASC").Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to load category rules: %s", err.Error())
+	}
+
+	rules := make([]*categoryRule, 0, len(records))
+	for _, r := range records {
+		rule, err := compileRule(r, categories)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// matchRule returns the first rule that matches the transaction, or nil.
+func matchRule(rules []*categoryRule, t *Transaction) *categoryRule {
+	for _, r := range rules {
+		if r.matches(t) {
+			return r
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"awesomeProject/db"
+	"awesomeProject/money"
+	"strings"
+	"testing"
+)
+
+func TestCompileRule(t *testing.T) {
+	amount := func(m money.Money) *money.Money { return &m }
+
+	tests := []struct {
+		name     string
+		rule     db.CategoryRule
+		err      string
+		category string
+	}{
+		{name: "party pattern", rule: db.CategoryRule{Category: "Food", PartyPattern: "mama put"}, category: "Food"},
+		{name: "category spelt loosely", rule: db.CategoryRule{Category: "internet & airtime", Direction: "Debit"}, category: "Internet/Airtime"},
+		{name: "no category", rule: db.CategoryRule{PartyPattern: "x"}, err: "category is required"},
+		{name: "unknown category", rule: db.CategoryRule{Category: "Holidays", PartyPattern: "x"}, err: "unknown category"},
+		{name: "group", rule: db.CategoryRule{Category: "Loans", PartyPattern: "x"}, err: "unknown category"},
+		{name: "UNKNOWN", rule: db.CategoryRule{Category: "UNKNOWN", PartyPattern: "x"}, err: "unknown category"},
+		{name: "no conditions", rule: db.CategoryRule{Category: "Food", Currency: "NGN"}, err: "at least one condition"},
+		{name: "min more than max", rule: db.CategoryRule{Category: "Food", MinAmount: amount(500), MaxAmount: amount(100)}, err: "min amount is more than max"},
+		{name: "unknown direction", rule: db.CategoryRule{Category: "Food", Direction: "sideways"}, err: "unknown direction"},
+		{name: "invalid party pattern", rule: db.CategoryRule{Category: "Food", PartyPattern: "mama ("}, err: "invalid party pattern"},
+		{name: "invalid description pattern", rule: db.CategoryRule{Category: "Food", DescriptionPattern: "[lunch"}, err: "invalid description pattern"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := compileRule(tt.rule, defaultCategories)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("compileRule() error = %v, want it to mention %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("compileRule() error = %v", err)
+			}
+			if got.Category != tt.category {
+				t.Errorf("compileRule() category = %q, want %q", got.Category, tt.category)
+			}
+		})
+	}
+}
+
+func TestRuleMatches(t *testing.T) {
+	amount := func(m money.Money) *money.Money { return &m }
+	// credit from JOHN DOE, debit to Mama Put, and a dollar card payment to NETFLIX
+	transactions := parseKudaLines(t, kudaLines[0], kudaLines[1], kudaLines[3])
+
+	tests := []struct {
+		name string
+		rule db.CategoryRule
+		want []bool
+	}{
+		{name: "party, ignoring case", rule: db.CategoryRule{PartyPattern: "mama put"}, want: []bool{false, true, false}},
+		{name: "description", rule: db.CategoryRule{DescriptionPattern: "^rent"}, want: []bool{true, false, false}},
+		{name: "direction", rule: db.CategoryRule{Direction: "debit"}, want: []bool{false, true, true}},
+		{name: "currency", rule: db.CategoryRule{Currency: "usd", Direction: "debit"}, want: []bool{false, false, true}},
+		{name: "inclusive amount range", rule: db.CategoryRule{MinAmount: amount(2500), MaxAmount: amount(250000)}, want: []bool{false, true, true}},
+		{name: "all conditions", rule: db.CategoryRule{Direction: "debit", Currency: "NGN", PartyPattern: "netflix"}, want: []bool{false, false, false}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.rule.Category = "Miscellaneous"
+			rule, err := compileRule(tt.rule, defaultCategories)
+			if err != nil {
+				t.Fatalf("compileRule() error = %v", err)
+			}
+			for i, tr := range transactions {
+				if got := rule.matches(tr); got != tt.want[i] {
+					t.Errorf("matches(%s) = %v, want %v", tr.Party, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
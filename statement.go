@@ -0,0 +1,372 @@
+package main
+
+import (
+	"awesomeProject/graph"
+	"awesomeProject/money"
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// statementColumns are the headers of the transaction table in Kuda's PDF and Excel statements,
+// in the order they're displayed.
+var statementColumns = []string{"Date/Time", "Money In", "Money Out", "Category", "To / From", "Description", "Balance"}
+
+const (
+	colDateTime = iota
+	colMoneyIn
+	colMoneyOut
+	colCategory
+	colParty
+	colDescription
+	colBalance
+	columnCount
+)
+
+// statementTimeLayout is the layout of the Date/Time column in Kuda statements.
+const statementTimeLayout = "02/01/06 15:04:05"
+
+// defaultStatementTimezone is the timezone Kuda prints statement times in.
+const defaultStatementTimezone = "Africa/Lagos"
+
+// statementLocation is the timezone statement times are read in. It's set by STATEMENT_TIMEZONE.
+var statementLocation = sync.OnceValue(func() *time.Location {
+	name := os.Getenv("STATEMENT_TIMEZONE")
+	if name == "" {
+		name = defaultStatementTimezone
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		slog.Error("invalid statement timezone, using the default", "timezone", name, "error", err.Error())
+		loc, _ = time.LoadLocation(defaultStatementTimezone)
+	}
+	return loc
+})
+
+// normalizeHeader lowercases a column header and strips its whitespace, so "To / From" matches "to/from".
+func normalizeHeader(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), ""))
+}
+
+// StatementInfo is the metadata printed above the transaction table of a statement.
+// Fields the statement didn't have are left empty; the period falls back to the dates of the transactions.
+type StatementInfo struct {
+	AccountHolder  string       `json:"accountHolder"`
+	AccountNumber  string       `json:"accountNumber"`
+	PeriodStart    time.Time    `json:"periodStart"`
+	PeriodEnd      time.Time    `json:"periodEnd"`
+	OpeningBalance *money.Money `json:"openingBalance"`
+	ClosingBalance *money.Money `json:"closingBalance"`
+	Currency       string       `json:"currency"`
+}
+
+var (
+	headerHolderPattern  = regexp.MustCompile(`(?i)^\s*(account\s*(holder|name)|customer\s*name)\s*[:\t]?\s*(.+?)\s*$`)
+	headerAccountPattern = regexp.MustCompile(`(?i)account\s*(number|no\.?)\s*[:\t]?\s*(\d{6,})`)
+	headerPeriodPattern  = regexp.MustCompile(`(?i)period`)
+	headerOpeningPattern = regexp.MustCompile(`(?i)opening\s*balance\s*[:\t]?\s*([A-Z₦$£€]*\s?-?[\d,]+(?:\.\d+)?)`)
+	headerClosingPattern = regexp.MustCompile(`(?i)closing\s*balance\s*[:\t]?\s*([A-Z₦$£€]*\s?-?[\d,]+(?:\.\d+)?)`)
+	headerDatePattern    = regexp.MustCompile(`\d{1,2}(/\d{1,2}/|-[A-Za-z]{3}-| [A-Za-z]{3,9},? )\d{2,4}|\d{4}-\d{2}-\d{2}`)
+)
+
+// headerDateLayouts are the date formats seen in statement periods.
+var headerDateLayouts = []string{"02/01/2006", "2/1/2006", "02/01/06", "02-Jan-2006", "02 Jan 2006", "2 Jan 2006", "02 January 2006", "2 January 2006", "2006-01-02"}
+
+// parseHeaderLine picks any statement metadata out of a line above the transaction table,
+// and reports whether the line held any.
+func (s *StatementInfo) parseHeaderLine(line string) bool {
+	matched := false
+
+	if m := headerAccountPattern.FindStringSubmatch(line); m != nil {
+		s.AccountNumber = m[2]
+		matched = true
+	} else if m := headerHolderPattern.FindStringSubmatch(line); m != nil {
+		s.AccountHolder = m[3]
+		matched = true
+	}
+
+	if headerPeriodPattern.MatchString(line) {
+		var dates []time.Time
+		for _, d := range headerDatePattern.FindAllString(line, -1) {
+			if t, ok := parseHeaderDate(d); ok {
+				dates = append(dates, t)
+			}
+		}
+		if len(dates) == 2 {
+			s.PeriodStart, s.PeriodEnd = dates[0], dates[1]
+			matched = true
+		}
+	}
+
+	if m := headerOpeningPattern.FindStringSubmatch(line); m != nil {
+		if currency, balance, err := parseAmount(m[1]); err == nil {
+			s.OpeningBalance = &balance
+			s.setCurrency(currency)
+			matched = true
+		}
+	}
+	if m := headerClosingPattern.FindStringSubmatch(line); m != nil {
+		if currency, balance, err := parseAmount(m[1]); err == nil {
+			s.ClosingBalance = &balance
+			s.setCurrency(currency)
+			matched = true
+		}
+	}
+
+	return matched
+}
+
+func (s *StatementInfo) setCurrency(currency string) {
+	if currency != "" {
+		s.Currency = currency
+	}
+}
+
+func parseHeaderDate(s string) (time.Time, bool) {
+	s = strings.ReplaceAll(strings.TrimSpace(s), ",", "")
+	for _, layout := range headerDateLayouts {
+		if t, err := time.ParseInLocation(layout, s, statementLocation()); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// fillCurrency gives a row without a currency symbol the statement's currency. The statement takes its
+// currency from the header, or else from the first row that had one.
+func (s *StatementInfo) fillCurrency(t *Transaction) {
+	if t.Currency != "" {
+		s.setCurrency(cmp.Or(s.Currency, t.Currency))
+		return
+	}
+	t.Currency = cmp.Or(s.Currency, money.DefaultCurrency)
+}
+
+// statementSpan tracks the earliest and latest transactions of a statement as it's read.
+// Ties go to the earlier row for the first transaction, and to the later row for the last.
+type statementSpan struct {
+	first, last *Transaction
+}
+
+func (s *statementSpan) add(t *Transaction) {
+	if s.first == nil || t.DateTime.Before(s.first.DateTime) {
+		s.first = t
+	}
+	if s.last == nil || !t.DateTime.Before(s.last.DateTime) {
+		s.last = t
+	}
+}
+
+// fill completes the metadata from the transactions when the statement didn't have a header.
+func (s *StatementInfo) fill(span statementSpan) {
+	if span.first == nil {
+		return
+	}
+
+	if s.PeriodStart.IsZero() {
+		s.PeriodStart = span.first.DateTime
+	}
+	if s.PeriodEnd.IsZero() {
+		s.PeriodEnd = span.last.DateTime
+	}
+	if s.Currency == "" {
+		s.Currency = span.first.Currency
+	}
+}
+
+// Key identifies the statement so uploading it twice maps to the same Statement node.
+// Without an account number there's nothing to tell statements apart, so each upload gets its own.
+func (s *StatementInfo) Key() string {
+	if s.AccountNumber == "" || s.PeriodStart.IsZero() {
+		return "upload:" + uuid.NewString()
+	}
+	return fmt.Sprintf("%s:%s:%s", s.AccountNumber, s.PeriodStart.Format("2006-01-02"), s.PeriodEnd.Format("2006-01-02"))
+}
+
+// Reconciliation compares the balances printed on the statement with the ones implied by its transactions.
+type Reconciliation struct {
+	OpeningBalance  *money.Money `json:"openingBalance"`
+	ComputedOpening *money.Money `json:"computedOpening"`
+	ClosingBalance  *money.Money `json:"closingBalance"`
+	ComputedClosing *money.Money `json:"computedClosing"`
+	Balanced        bool         `json:"balanced"`
+}
+
+// reconcile checks the statement's opening balance against the balance before its earliest transaction,
+// and its closing balance against the balance after its latest one.
+func (s *StatementInfo) reconcile(span statementSpan) Reconciliation {
+	r := Reconciliation{OpeningBalance: s.OpeningBalance, ClosingBalance: s.ClosingBalance, Balanced: true}
+	if span.first == nil {
+		return r
+	}
+
+	opening := span.first.Balance - span.first.signedAmount()
+	closing := span.last.Balance
+	r.ComputedOpening, r.ComputedClosing = &opening, &closing
+
+	if s.OpeningBalance != nil && *s.OpeningBalance != opening {
+		r.Balanced = false
+	}
+	if s.ClosingBalance != nil && *s.ClosingBalance != closing {
+		r.Balanced = false
+	}
+	return r
+}
+
+// saveStatement saves the statement's metadata under key and returns the id of its Statement node.
+// Saving the same key again, from a later upload or later in the same one, updates the existing node.
+func saveStatement(info *StatementInfo, key, filename string, reconciliation Reconciliation) (string, error) {
+	graphConn, err := graph.NewGraphConn()
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to graph database: %s", err.Error())
+	}
+	defer graphConn.Close()
+
+	query := `
+	MERGE (s:Statement {key: $key})
+	ON CREATE SET s.id = randomUUID()
+	SET s.accountHolder = $accountHolder, s.accountNumber = $accountNumber, s.periodStart = $periodStart, s.periodEnd = $periodEnd,
+		s.openingBalance = $openingBalance, s.closingBalance = $closingBalance, s.currency = $currency,
+		s.filename = $filename, s.balanced = $balanced, s.importedAt = datetime()
+	RETURN s.id AS id`
+
+	params := map[string]interface{}{
+		"key":            key,
+		"accountHolder":  info.AccountHolder,
+		"accountNumber":  info.AccountNumber,
+		"periodStart":    nullableTime(info.PeriodStart),
+		"periodEnd":      nullableTime(info.PeriodEnd),
+		"openingBalance": nullableMoney(info.OpeningBalance),
+		"closingBalance": nullableMoney(info.ClosingBalance),
+		"currency":       info.Currency,
+		"filename":       filename,
+		"balanced":       reconciliation.Balanced,
+	}
+
+	res, err := graphConn.Execute(context.Background(), query, params)
+	if err != nil {
+		return "", fmt.Errorf("failed to execute query: %s", err.Error())
+	}
+	if len(res.Records) == 0 {
+		return "", fmt.Errorf("failed to save statement: no record returned")
+	}
+
+	id, _, err := neo4j.GetRecordValue[string](res.Records[0], "id")
+	return id, err
+}
+
+// statementTotals adds up the credits and debits of a saved statement per currency,
+// leaving out transactions that were reversed.
+func statementTotals(statementID string) (map[string]money.Money, map[string]money.Money, error) {
+	graphConn, err := graph.NewGraphConn()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to graph database: %s", err.Error())
+	}
+	defer graphConn.Close()
+
+	res, err := graphConn.Execute(context.Background(), `
+	MATCH (t:Transaction)-[:FROM_STATEMENT]->(:Statement {id: $id})
+	WHERE NOT coalesce(t.reversed, false)
+	RETURN t.currency AS currency, t.type AS type, sum(t.amount) AS total`, map[string]interface{}{"id": statementID})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to execute query: %s", err.Error())
+	}
+
+	totalIn, totalOut := make(map[string]money.Money), make(map[string]money.Money)
+	for _, record := range res.Records {
+		currency, _, _ := neo4j.GetRecordValue[string](record, "currency")
+		kind, _, _ := neo4j.GetRecordValue[string](record, "type")
+		total, _, err := neo4j.GetRecordValue[int64](record, "total")
+		if err != nil {
+			return nil, nil, err
+		}
+		if kind == "Debit" {
+			totalOut[currency] += money.Money(total)
+		} else {
+			totalIn[currency] += money.Money(total)
+		}
+	}
+	return totalIn, totalOut, nil
+}
+
+// listStatements returns every imported statement, most recent period first.
+func listStatements(ctx context.Context, conn *graph.Conn) ([]map[string]any, error) {
+	res, err := conn.Execute(ctx, `
+	MATCH (s:Statement)
+	RETURN s, COUNT { (t:Transaction)-[:FROM_STATEMENT]->(s) } AS transactions
+	ORDER BY s.periodEnd DESC`, map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+
+	statements := make([]map[string]any, 0, len(res.Records))
+	for _, record := range res.Records {
+		node, _, err := neo4j.GetRecordValue[neo4j.Node](record, "s")
+		if err != nil {
+			return nil, err
+		}
+		count, _, err := neo4j.GetRecordValue[int64](record, "transactions")
+		if err != nil {
+			return nil, err
+		}
+
+		statement := node.Props
+		statement["transactions"] = count
+		statements = append(statements, statement)
+	}
+	return statements, nil
+}
+
+// deleteStatement deletes a statement along with the transactions that came from it.
+// Transactions that also appear in another statement are kept.
+// It returns the number of transactions deleted, or false if there's no such statement.
+func deleteStatement(ctx context.Context, conn *graph.Conn, id string) (int64, bool, error) {
+	res, err := conn.Execute(ctx, `
+	MATCH (s:Statement {id: $id})
+	OPTIONAL MATCH (t:Transaction)-[:FROM_STATEMENT]->(s)
+	WHERE COUNT { (t)-[:FROM_STATEMENT]->(:Statement) } = 1
+	WITH s, collect(t) AS transactions
+	FOREACH (t IN transactions | DETACH DELETE t)
+	DETACH DELETE s
+	RETURN size(transactions) AS deleted`, map[string]interface{}{"id": id})
+	if err != nil {
+		return 0, false, err
+	}
+	if len(res.Records) == 0 {
+		return 0, false, nil
+	}
+
+	deleted, _, err := neo4j.GetRecordValue[int64](res.Records[0], "deleted")
+	return deleted, true, err
+}
+
+func nullableTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
+
+func nullableString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func nullableMoney(m *money.Money) any {
+	if m == nil {
+		return nil
+	}
+	return m.Kobo()
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"awesomeProject/money"
+	"testing"
+	"time"
+)
+
+func TestParseHeaderLine(t *testing.T) {
+	lagos, _ := time.LoadLocation("Africa/Lagos")
+	balance := func(m money.Money) *money.Money { return &m }
+
+	tests := []struct {
+		name string
+		line string
+		want StatementInfo
+		ok   bool
+	}{
+		{name: "holder", line: "Account Holder: JOHN DOE", want: StatementInfo{AccountHolder: "JOHN DOE"}, ok: true},
+		{name: "customer name with a tab", line: "Customer Name\tJane Doe ", want: StatementInfo{AccountHolder: "Jane Doe"}, ok: true},
+		{name: "account number", line: "Account Number: 2012345678", want: StatementInfo{AccountNumber: "2012345678"}, ok: true},
+		{name: "account no", line: "Account No. 2012345678", want: StatementInfo{AccountNumber: "2012345678"}, ok: true},
+		{name: "account number too short", line: "Account Number: 12345"},
+		{
+			name: "slashed period",
+			line: "Statement Period: 01/03/2024 - 31/03/2024",
+			want: StatementInfo{PeriodStart: time.Date(2024, 3, 1, 0, 0, 0, 0, lagos), PeriodEnd: time.Date(2024, 3, 31, 0, 0, 0, 0, lagos)},
+			ok:   true,
+		},
+		{
+			name: "written period",
+			line: "Period 1 March, 2024 to 31 March, 2024",
+			want: StatementInfo{PeriodStart: time.Date(2024, 3, 1, 0, 0, 0, 0, lagos), PeriodEnd: time.Date(2024, 3, 31, 0, 0, 0, 0, lagos)},
+			ok:   true,
+		},
+		{name: "period with one date", line: "Period: 2024-03-01"},
+		{name: "opening balance", line: "Opening Balance: ₦10,000.50", want: StatementInfo{OpeningBalance: balance(1000050), Currency: "NGN"}, ok: true},
+		{name: "closing balance", line: "Closing Balance\t$250.00", want: StatementInfo{ClosingBalance: balance(25000), Currency: "USD"}, ok: true},
+		{name: "balance without currency", line: "Closing balance 1,500", want: StatementInfo{ClosingBalance: balance(150000)}, ok: true},
+		{name: "nothing", line: "Thank you for banking with us"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got StatementInfo
+			if ok := got.parseHeaderLine(tt.line); ok != tt.ok {
+				t.Errorf("parseHeaderLine(%q) = %v, want %v", tt.line, ok, tt.ok)
+			}
+
+			if got.AccountHolder != tt.want.AccountHolder || got.AccountNumber != tt.want.AccountNumber || got.Currency != tt.want.Currency {
+				t.Errorf("parseHeaderLine(%q) = %+v, want %+v", tt.line, got, tt.want)
+			}
+			if !got.PeriodStart.Equal(tt.want.PeriodStart) || !got.PeriodEnd.Equal(tt.want.PeriodEnd) {
+				t.Errorf("parseHeaderLine(%q) period = %s to %s, want %s to %s", tt.line, got.PeriodStart, got.PeriodEnd, tt.want.PeriodStart, tt.want.PeriodEnd)
+			}
+			for _, b := range []struct {
+				name      string
+				got, want *money.Money
+			}{{"opening", got.OpeningBalance, tt.want.OpeningBalance}, {"closing", got.ClosingBalance, tt.want.ClosingBalance}} {
+				if (b.got == nil) != (b.want == nil) || (b.got != nil && *b.got != *b.want) {
+					t.Errorf("parseHeaderLine(%q) %s balance = %v, want %v", tt.line, b.name, b.got, b.want)
+				}
+			}
+		})
+	}
+}
@@ -2,25 +2,49 @@ package main
 
 import (
 	"awesomeProject/graph"
+	"awesomeProject/money"
 	"bufio"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"log"
-	"mime/multipart"
+	"io"
+	"iter"
+	"log/slog"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
 )
 
 type Transaction struct {
-	DateTime    time.Time `json:"transactionTime"`
-	Amount      float64   `json:"amount"`
-	Type        int       `json:"-"`
-	TypeString  string    `json:"type"`
+	DateTime time.Time   `json:"transactionTime"`
+	Amount   money.Money `json:"amount"`
+	// Currency is the ISO 4217 code of Amount and Balance, empty until it's known.
+	Currency    string `json:"currency"`
+	Type        int    `json:"-"`
+	TypeString  string `json:"type"`
 	Category    string
 	Party       string
 	Description string
-	Balance     float64
+	Balance     money.Money
+	// Line is where the transaction was found in the statement, used when reporting problems with it.
+	Line int `json:"line"`
+	// IsFee is set for bank charges, levies and taxes. They're linked to the transfer they were charged for once saved.
+	IsFee bool `json:"isFee"`
+	// IsReversal is set for the credits reversing a failed transfer or refunding a payment. They're linked to the
+	// debit they pay back in full once saved.
+	IsReversal bool `json:"isReversal"`
+	// Rule is the id of the category rule that decided the category, empty when the model did.
+	Rule string `json:"rule,omitempty"`
+	// RawCategory is the model's answer when it wasn't one of the categories and Category was set to UNKNOWN.
+	RawCategory string `json:"rawCategory,omitempty"`
+	// Confidence is how sure the categorizer is of Category, from 0 to 1, and Reason is why it chose it.
+	// Transactions below reviewConfidence are queued for review.
+	Confidence float64 `json:"confidence"`
+	Reason     string  `json:"reason,omitempty"`
 }
 
 func (t Transaction) String() string {
@@ -31,78 +55,147 @@ func (t Transaction) String() string {
 		transactionType = "CREDIT"
 	}
 
-	return fmt.Sprintf("%s: Date: %s; Amount: %.2f; Party: %s; Description: %s", transactionType, t.DateTime, t.Amount, t.Party, t.Description)
+	return fmt.Sprintf("%s: Date: %s; Amount: %s %s; Party: %s; Description: %s", transactionType, t.DateTime, t.Currency, t.Amount, t.Party, t.Description)
 }
 
-func parseFile(file multipart.File) []*Transaction {
-	reader := bufio.NewScanner(file)
-	transactions := make([]*Transaction, 0)
+// parseFile reads a statement copy-pasted from Kuda's PDF line by line, yielding each row as soon as it's read.
+// Lines that aren't transactions may be the statement's header and are recorded in info.
+// A line longer than maxLineLength stops the parse with ErrLineTooLong.
+func parseFile(file io.Reader, maxLineLength int, info *StatementInfo) iter.Seq2[ParsedRow, error] {
+	return func(yield func(ParsedRow, error) bool) {
+		reader := bufio.NewScanner(file)
+		// the buffer grows as needed, the extra byte leaves room for the newline
+		reader.Buffer(make([]byte, 0, min(maxLineLength+1, bufio.MaxScanTokenSize)), maxLineLength+1)
+
+		lineNo := 0
+		for reader.Scan() {
+			lineNo++
+			var line = reader.Text()
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
 
-	for reader.Scan() {
-		var line = reader.Text()
+			t, err := parseLine(line)
+			if err != nil {
+				if info.parseHeaderLine(line) {
+					continue
+				}
+				if !yield(rejectedRow(lineNo, line, err), nil) {
+					return
+				}
+				continue
+			}
+			if !yield(transactionRow(t, lineNo), nil) {
+				return
+			}
+		}
 
-		t, err := parseLine(line)
-		if err != nil {
-			log.Println("failed to parse line", line)
-		} else {
-			transactions = append(transactions, t)
+		if err := reader.Err(); err != nil {
+			if errors.Is(err, bufio.ErrTooLong) {
+				err = fmt.Errorf("%w: line %d is longer than %d bytes, raise MAX_LINE_LENGTH to import it", ErrLineTooLong, lineNo+1, maxLineLength)
+			} else {
+				err = fmt.Errorf("failed to read line %d: %s", lineNo+1, err.Error())
+			}
+			yield(ParsedRow{}, err)
 		}
 	}
-	return transactions
 }
 
+// parseLine reads a single row of a statement copy-pasted from Kuda's PDF. Malformed lines, such as page
+// footers or rows cut short, are rejected with one of the errors above rather than guessed at.
 func parseLine(line string) (*Transaction, error) {
-	var fields = splitLine(line)
-	timeStr, amountStr, category, party, description, balanceStr := fields[0], fields[1], fields[3], fields[4], fields[5], fields[6]
+	if strings.TrimSpace(line) == "" {
+		return nil, ErrEmptyLine
+	}
 
-	if amountStr == string(rune(9)) {
-		amountStr = fields[2]
+	var fields = splitLine(line)
+	if len(fields) != columnCount {
+		return nil, fmt.Errorf("%w: expected %d fields, got %d", ErrFieldCount, columnCount, len(fields))
 	}
 
-	timeStr = strings.Trim(timeStr, string(rune(9)))
-	amountStr = strings.Trim(amountStr[3:], string(rune(9))) // starting from index 3 to remove the ₦ character
-	amountStr = strings.ReplaceAll(amountStr, ",", "")
+	trim := func(s string) string { return strings.TrimSpace(strings.Trim(s, string(rune(9)))) }
+	return buildTransaction(
+		trim(fields[colDateTime]),
+		trim(fields[colMoneyIn]),
+		trim(fields[colMoneyOut]),
+		trim(fields[colCategory]),
+		trim(fields[colParty]),
+		trim(fields[colDescription]),
+		trim(fields[colBalance]),
+	)
+}
 
-	balanceStr = strings.Trim(balanceStr[3:], string(rune(9)))
-	balanceStr = strings.ReplaceAll(balanceStr, ",", "")
+// buildTransaction converts the cells of a single statement row into a Transaction.
+// Exactly one of moneyIn and moneyOut is expected to hold an amount; the row is a debit when moneyOut is set.
+func buildTransaction(timeStr, moneyIn, moneyOut, category, party, description, balanceStr string) (*Transaction, error) {
+	dateTime, err := time.ParseInLocation(statementTimeLayout, timeStr, statementLocation())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidDate, err.Error())
+	}
 
-	category = strings.Trim(category, string(rune(9)))
-	party = strings.Trim(party, string(rune(9)))
-	description = strings.Trim(description, string(rune(9)))
+	var amountStr string
+	switch {
+	case moneyIn == "" && moneyOut == "":
+		return nil, ErrMissingAmount
+	case moneyIn != "" && moneyOut != "":
+		return nil, fmt.Errorf("%w: both money in (%s) and money out (%s) are set", ErrAmbiguousAmount, moneyIn, moneyOut)
+	case moneyIn != "":
+		amountStr = moneyIn
+	default:
+		amountStr = moneyOut
+	}
 
-	dateTime, err := time.Parse("02/01/06 15:04:05", timeStr)
+	currency, amount, err := parseAmount(amountStr)
 	if err != nil {
-		return nil, fmt.Errorf("%s:%s", "invalid date", err.Error())
+		return nil, fmt.Errorf("%w: %s", ErrInvalidAmount, err.Error())
+	}
+	if amount < 0 {
+		return nil, fmt.Errorf("%w: negative amount %s", ErrInvalidAmount, amountStr)
 	}
 
-	amount, err := strconv.ParseFloat(amountStr, 64)
+	balanceCurrency, balance, err := parseAmount(balanceStr)
 	if err != nil {
-		return nil, fmt.Errorf("%s:%s", "invalid amount", err.Error())
+		return nil, fmt.Errorf("%w: %s", ErrInvalidBalance, err.Error())
 	}
 
-	balance, err := strconv.ParseFloat(balanceStr, 64)
-	if err != nil {
-		return nil, fmt.Errorf("%s:%s", "invalid balance", err.Error())
+	if currency == "" {
+		currency = balanceCurrency
+	} else if balanceCurrency != "" && balanceCurrency != currency {
+		return nil, fmt.Errorf("%w: amount is in %s but balance is in %s", ErrCurrencyMismatch, currency, balanceCurrency)
 	}
 
 	var transaction = Transaction{
 		DateTime:    dateTime,
 		Amount:      amount,
+		Currency:    currency,
 		Category:    category,
 		Party:       party,
 		Description: description,
 		Balance:     balance,
 	}
 
-	if fields[2] != string(rune(9)) {
-		transaction.Type = -1
-		transaction.TypeString = "Debit"
+	transaction.setType(moneyOut != "")
+	return &transaction, nil
+}
+
+// setType marks the transaction as a debit or a credit.
+func (t *Transaction) setType(debit bool) {
+	if debit {
+		t.Type = -1
+		t.TypeString = "Debit"
 	} else {
-		transaction.Type = +1
-		transaction.TypeString = "Credit"
+		t.Type = +1
+		t.TypeString = "Credit"
 	}
+}
 
-	return &transaction, nil
+// parseAmount parses an amount such as "₦12,500.00" or "$25.00" into its currency and minor units.
+// The currency is empty when the amount has no symbol.
+func parseAmount(s string) (string, money.Money, error) {
+	currency, s := money.SplitCurrency(s)
+	s = strings.ReplaceAll(s, ",", "")
+	amount, err := money.Parse(s)
+	return currency, amount, err
 }
 
 func splitLine(line string) []string {
@@ -120,84 +213,135 @@ func splitLine(line string) []string {
 	})
 }
 
-func createCategories() {
-	category := []string{
-		"Family",
-		"Girlfriend",
-		"Food",
-		"Internet/Airtime",
-		"Clothing",
-		"Debt",
-		"Cowrywise In",
-		"Cowrywise Out",
-		"Electricity Bill",
-		"Miscellaneous",
-		"Church",
-		"Transportation",
-		"Personal Care",
-		"Subscriptions",
-		"Drinks",
-		"LoanPayment-Out",
-		"LoanPayment-In",
-		"LoanRepayment-Out",
-		"LoanRepayment-In",
-		"Salary",
-	}
-
-	conn, err := graph.NewGraphConn()
+// Fingerprint identifies a transaction across uploads, so the same row in two overlapping statements
+// is only stored once. Whitespace and case differences in the party and description are ignored,
+// since they vary between the PDF, Excel and copy-pasted statements.
+func (t *Transaction) Fingerprint() string {
+	normalize := func(s string) string {
+		return strings.ToLower(strings.Join(strings.Fields(s), " "))
+	}
+
+	fields := []string{
+		t.DateTime.UTC().Format(time.RFC3339),
+		strconv.FormatInt(t.Amount.Kobo(), 10),
+		t.TypeString,
+		strconv.FormatInt(t.Balance.Kobo(), 10),
+		normalize(t.Party),
+		normalize(t.Description),
+	}
+	// naira transactions were fingerprinted before currencies were tracked, leave them out to keep those stable
+	if t.Currency != "" && t.Currency != money.DefaultCurrency {
+		fields = append(fields, t.Currency)
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join(fields, "\x1f")))
+	return hex.EncodeToString(sum[:])
+}
+
+// transactionExists reports whether a transaction with the same fingerprint has already been saved
+func transactionExists(t *Transaction) (bool, error) {
+	graphConn, err := graph.NewGraphConn()
 	if err != nil {
-		panic(fmt.Errorf("failed to connect to graph: %s", err.Error()))
-	}
-	defer conn.Close()
-
-	for _, cat := range category {
-		_, err := conn.Execute(
-			context.Background(),
-			`
-			CREATE (c:Category {name: $name})
- 			RETURN c
-			`,
-			map[string]interface{}{"name": cat})
-		if err != nil {
-			panic(err)
-		}
+		return false, fmt.Errorf("failed to connect to graph database: %s", err.Error())
+	}
+	defer graphConn.Close()
+
+	res, err := graphConn.Execute(
+		context.Background(),
+		`MATCH (t:Transaction {fingerprint: $fingerprint}) RETURN t.fingerprint`,
+		map[string]interface{}{"fingerprint": t.Fingerprint()},
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to execute query: %s", err.Error())
 	}
+	return len(res.Records) > 0, nil
 }
 
-// saveTransaction saves a transaction to the database
-func saveTransaction(t *Transaction) error {
+// linkToStatement records that a transaction saved by an earlier upload also appears in this statement
+func linkToStatement(t *Transaction, statementID string) error {
 	graphConn, err := graph.NewGraphConn()
 	if err != nil {
 		return fmt.Errorf("failed to connect to graph database: %s", err.Error())
 	}
 	defer graphConn.Close()
 
+	_, err = graphConn.Execute(
+		context.Background(),
+		`MATCH (t:Transaction {fingerprint: $fingerprint}), (s:Statement {id: $statementId}) MERGE (t)-[:FROM_STATEMENT]->(s)`,
+		map[string]interface{}{"fingerprint": t.Fingerprint(), "statementId": statementID},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to execute query: %s", err.Error())
+	}
+	return nil
+}
+
+// saveTransaction saves a transaction to the database and links it to the statement it came from.
+// It returns false if the transaction had already been saved by an earlier upload.
+func saveTransaction(t *Transaction, statementID string) (bool, error) {
+	graphConn, err := graph.NewGraphConn()
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to graph database: %s", err.Error())
+	}
+	defer graphConn.Close()
+
+	// datetime() is fixed for the whole query, so importedAt only equals it when this query created the node.
+	// Only the query that created the transaction links its category and counterparty, so a transaction
+	// saved by an earlier or concurrent import isn't given a second category.
 	query := `
-	MERGE (c:Category {name: $category})
-	CREATE (t:Transaction {dateTime: $dateTime, amount: $amount, type: $type, party: $party, description: $description, balance: $balance})
-	MERGE (t)-[:BELONGS_TO]->(c)
-	RETURN t`
+	MERGE (t:Transaction {fingerprint: $fingerprint})
+	ON CREATE SET t.dateTime = $dateTime, t.amount = $amount, t.currency = $currency, t.type = $type, t.party = $party, t.description = $description, t.balance = $balance, t.reversed = false, t.rule = $rule, t.rawCategory = $rawCategory, t.confidence = $confidence, t.reason = $reason, t.importedAt = datetime()
+	WITH t, t.importedAt = datetime() AS created
+	MATCH (s:Statement {id: $statementId})
+	MERGE (t)-[:FROM_STATEMENT]->(s)
+	WITH t, created
+	FOREACH (_ IN CASE WHEN created THEN [1] ELSE [] END |
+		MERGE (c:Category {name: $category})
+		ON CREATE SET c.id = randomUUID()
+		MERGE (t)-[:BELONGS_TO]->(c)`
 
 	params := map[string]interface{}{
+		"fingerprint": t.Fingerprint(),
 		"dateTime":    t.DateTime,
-		"amount":      t.Amount,
+		"amount":      t.Amount.Kobo(),
+		"currency":    t.Currency,
 		"type":        t.TypeString,
 		"category":    t.Category,
 		"party":       t.Party,
 		"description": t.Description,
-		"balance":     t.Balance,
+		"balance":     t.Balance.Kobo(),
+		"statementId": statementID,
+		"rule":        nullableString(t.Rule),
+		"rawCategory": nullableString(t.RawCategory),
+		"confidence":  t.Confidence,
+		"reason":      nullableString(t.Reason),
 	}
 
+	if counterparty := parseCounterparty(t.Party); counterparty != nil {
+		query += `
+		MERGE (p:Counterparty {key: $counterpartyKey})
+		ON CREATE SET p.name = $counterpartyName, p.accountNumber = $accountNumber, p.bank = $bank
+		MERGE (t)-[:` + t.counterpartyRelationship() + `]->(p)`
+		params["counterpartyKey"] = counterparty.Key()
+		params["counterpartyName"] = counterparty.Name
+		params["accountNumber"] = counterparty.AccountNumber
+		params["bank"] = counterparty.Bank
+	}
+	query += `
+	)
+	RETURN created`
+
 	res, err := graphConn.Execute(context.Background(), query, params)
 	if err != nil {
-		return fmt.Errorf("failed to execute query: %s", err.Error())
+		return false, fmt.Errorf("failed to execute query: %s", err.Error())
 	}
 
-	summary := res.Summary
-	counters := summary.Counters()
-	fmt.Println("Nodes created", counters.NodesCreated())
-	fmt.Println("Labels added", counters.LabelsAdded())
-	fmt.Println("Properties set:", counters.PropertiesSet())
-	fmt.Println("Relationships created", counters.RelationshipsCreated())
-	return nil
+	counters := res.Summary.Counters()
+	slog.Debug("saved transaction", "nodesCreated", counters.NodesCreated(), "propertiesSet", counters.PropertiesSet(), "relationshipsCreated", counters.RelationshipsCreated())
+
+	if len(res.Records) == 0 {
+		return false, fmt.Errorf("failed to save transaction: no record returned")
+	}
+	created, _, err := neo4j.GetRecordValue[bool](res.Records[0], "created")
+	return created, err
 }
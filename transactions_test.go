@@ -0,0 +1,136 @@
+package main
+
+import (
+	"awesomeProject/money"
+	"errors"
+	"testing"
+	"time"
+)
+
+// kudaLines are rows copy-pasted from Kuda statements, with names and account numbers changed.
+// Every cell ends in a tab and cells are separated by another, so an empty cell is a lone tab.
+var kudaLines = []string{
+	"12/03/24 14:05:11\t\t₦15,000.00\t\t\t\tInward Transfer\t\tJOHN DOE/0123456789/GTBank\t\tRent contribution\t\t₦27,450.00",
+	"12/03/24 18:40:02\t\t\t\t₦2,500.00\t\tOutward Transfer\t\tMama Put Kitchen/1234567890/Providus\t\tlunch\t\t₦24,950.00",
+	"13/03/24 09:12:45\t\t\t\t₦10.00\t\tBank Charges\t\tKuda\t\tTransfer fee\t\t₦24,940.00",
+	"14/03/24 23:59:59\t\t\t\t$25.00\t\tCard Payment\t\tNETFLIX.COM\t\tSubscription\t\t$100.00",
+	"15/03/24 07:30:00\t\t1,000.00\t\t\t\tInward Transfer\t\tJANE DOE/9876543210/Kuda\t\tRefund\t\t25,940.00",
+}
+
+func TestParseLine(t *testing.T) {
+	lagos, _ := time.LoadLocation("Africa/Lagos")
+
+	tests := []struct {
+		name     string
+		line     string
+		err      error
+		amount   money.Money
+		balance  money.Money
+		currency string
+		debit    bool
+		party    string
+		at       time.Time
+	}{
+		{name: "credit", line: kudaLines[0], amount: 1500000, balance: 2745000, currency: "NGN", party: "JOHN DOE/0123456789/GTBank", at: time.Date(2024, 3, 12, 14, 5, 11, 0, lagos)},
+		{name: "debit", line: kudaLines[1], amount: 250000, balance: 2495000, currency: "NGN", debit: true, party: "Mama Put Kitchen/1234567890/Providus", at: time.Date(2024, 3, 12, 18, 40, 2, 0, lagos)},
+		{name: "fee", line: kudaLines[2], amount: 1000, balance: 2494000, currency: "NGN", debit: true, party: "Kuda", at: time.Date(2024, 3, 13, 9, 12, 45, 0, lagos)},
+		{name: "dollar card", line: kudaLines[3], amount: 2500, balance: 10000, currency: "USD", debit: true, party: "NETFLIX.COM", at: time.Date(2024, 3, 14, 23, 59, 59, 0, lagos)},
+		{name: "no currency symbol", line: kudaLines[4], amount: 100000, balance: 2594000, currency: "", party: "JANE DOE/9876543210/Kuda", at: time.Date(2024, 3, 15, 7, 30, 0, 0, lagos)},
+
+		{name: "empty line", line: "", err: ErrEmptyLine},
+		{name: "blank row with a tab", line: "\t", err: ErrEmptyLine},
+		{name: "blank row with spaces and tabs", line: " \t\t ", err: ErrEmptyLine},
+		{name: "page footer", line: "Page 3 of 12", err: ErrFieldCount},
+		{name: "footer with tabs", line: "kuda.com\t\tPage 3 of 12", err: ErrFieldCount},
+		{name: "row cut short", line: "12/03/24 14:05:11\t\t₦15,000.00\t\t\t\tInward Transfer", err: ErrFieldCount},
+		{name: "extra cells", line: kudaLines[0] + "\t\textra", err: ErrFieldCount},
+		{name: "table header", line: "Date/Time\t\tMoney In\t\tMoney Out\t\tCategory\t\tTo / From\t\tDescription\t\tBalance", err: ErrInvalidDate},
+		{name: "date without time", line: "12/03/24\t\t₦15,000.00\t\t\t\tInward Transfer\t\tJOHN DOE\t\tRent\t\t₦27,450.00", err: ErrInvalidDate},
+		{name: "impossible date", line: "31/02/24 14:05:11\t\t₦15,000.00\t\t\t\tInward Transfer\t\tJOHN DOE\t\tRent\t\t₦27,450.00", err: ErrInvalidDate},
+		{name: "no amount", line: "12/03/24 14:05:11\t\t\t\t\t\tInward Transfer\t\tJOHN DOE\t\tRent\t\t₦27,450.00", err: ErrMissingAmount},
+		{name: "both amounts", line: "12/03/24 14:05:11\t\t₦15,000.00\t\t₦15,000.00\t\tInward Transfer\t\tJOHN DOE\t\tRent\t\t₦27,450.00", err: ErrAmbiguousAmount},
+		{name: "garbled amount", line: "12/03/24 14:05:11\t\t₦15,0x0.00\t\t\t\tInward Transfer\t\tJOHN DOE\t\tRent\t\t₦27,450.00", err: ErrInvalidAmount},
+		{name: "currency symbol only", line: "12/03/24 14:05:11\t\t₦\t\t\t\tInward Transfer\t\tJOHN DOE\t\tRent\t\t₦27,450.00", err: ErrInvalidAmount},
+		{name: "negative amount", line: "12/03/24 14:05:11\t\t-₦15,000.00\t\t\t\tInward Transfer\t\tJOHN DOE\t\tRent\t\t₦27,450.00", err: ErrInvalidAmount},
+		{name: "huge amount", line: "12/03/24 14:05:11\t\t₦999999999999999999999.00\t\t\t\tInward Transfer\t\tJOHN DOE\t\tRent\t\t₦27,450.00", err: ErrInvalidAmount},
+		{name: "missing balance", line: "12/03/24 14:05:11\t\t₦15,000.00\t\t\t\tInward Transfer\t\tJOHN DOE\t\tRent\t\t\t", err: ErrInvalidBalance},
+		{name: "garbled balance", line: "12/03/24 14:05:11\t\t₦15,000.00\t\t\t\tInward Transfer\t\tJOHN DOE\t\tRent\t\tN/A", err: ErrInvalidBalance},
+		{name: "mixed currencies", line: "12/03/24 14:05:11\t\t₦15,000.00\t\t\t\tInward Transfer\t\tJOHN DOE\t\tRent\t\t$27,450.00", err: ErrCurrencyMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseLine(tt.line)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("parseLine() error = %v, want %v", err, tt.err)
+				}
+				if got != nil {
+					t.Fatalf("parseLine() = %v, want nil alongside the error", got)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("parseLine() error = %v", err)
+			}
+			if got.Amount != tt.amount || got.Balance != tt.balance || got.Currency != tt.currency {
+				t.Errorf("parseLine() = %s %s balance %s, want %s %s balance %s", got.Currency, got.Amount, got.Balance, tt.currency, tt.amount, tt.balance)
+			}
+			if debit := got.Type == -1; debit != tt.debit {
+				t.Errorf("parseLine() debit = %v, want %v", debit, tt.debit)
+			}
+			if got.Party != tt.party {
+				t.Errorf("parseLine() party = %q, want %q", got.Party, tt.party)
+			}
+			if !got.DateTime.Equal(tt.at) {
+				t.Errorf("parseLine() time = %s, want %s", got.DateTime, tt.at)
+			}
+		})
+	}
+}
+
+// lineErrors are the errors parseLine may reject a line with.
+var lineErrors = []error{
+	ErrEmptyLine, ErrFieldCount, ErrInvalidDate, ErrMissingAmount, ErrAmbiguousAmount,
+	ErrInvalidAmount, ErrInvalidBalance, ErrCurrencyMismatch,
+}
+
+// FuzzParseLine checks that no line, however malformed, panics the parser, and that every
+// line is either parsed into a sane transaction or rejected with one of lineErrors.
+func FuzzParseLine(f *testing.F) {
+	for _, line := range kudaLines {
+		f.Add(line)
+	}
+	f.Add("")
+	f.Add("\t")
+	f.Add("Page 3 of 12")
+	f.Add("Date/Time\t\tMoney In\t\tMoney Out\t\tCategory\t\tTo / From\t\tDescription\t\tBalance")
+	f.Add("12/03/24 14:05:11\t\t₦\t\t\t\t\t\t\t\t\t\t₦")
+	f.Add("12/03/24 14:05:11\t\t-\t\t\t\t\t\t\t\t\t\t.")
+
+	f.Fuzz(func(t *testing.T, line string) {
+		got, err := parseLine(line)
+		if err != nil {
+			if got != nil {
+				t.Fatalf("parseLine(%q) returned a transaction alongside error %v", line, err)
+			}
+			for _, e := range lineErrors {
+				if errors.Is(err, e) {
+					return
+				}
+			}
+			t.Fatalf("parseLine(%q) error %v isn't one of the line errors", line, err)
+		}
+
+		if got == nil {
+			t.Fatalf("parseLine(%q) returned neither a transaction nor an error", line)
+		}
+		if got.Amount < 0 {
+			t.Errorf("parseLine(%q) amount = %s, want it to be positive", line, got.Amount)
+		}
+		if got.Type != -1 && got.Type != 1 {
+			t.Errorf("parseLine(%q) type = %d, want -1 or 1", line, got.Type)
+		}
+	})
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// excelize reads the whole workbook into memory before its rows can be streamed, so unlike the text
+// and CSV parsers there's no line to limit. The workbook is capped instead, both as uploaded and once
+// it's unzipped, so a small file can't expand without bound.
+const (
+	maxWorkbookSize      = 32 << 20
+	maxWorkbookUnzipSize = 256 << 20
+)
+
+// parseXLSX extracts the transactions from an Excel statement exported from the Kuda app, streaming
+// each sheet a row at a time. Every sheet is scanned for the transaction table header; the columns are
+// located by name, so their order in the sheet doesn't matter.
+func parseXLSX(file io.Reader, size int64, info *StatementInfo) iter.Seq2[ParsedRow, error] {
+	return func(yield func(ParsedRow, error) bool) {
+		if size > maxWorkbookSize {
+			yield(ParsedRow{}, fmt.Errorf("workbook is %d bytes, larger than the %d bytes accepted", size, maxWorkbookSize))
+			return
+		}
+
+		workbook, err := excelize.OpenReader(io.LimitReader(file, maxWorkbookSize+1), excelize.Options{UnzipSizeLimit: maxWorkbookUnzipSize})
+		if err != nil {
+			yield(ParsedRow{}, fmt.Errorf("failed to open workbook: %s", err.Error()))
+			return
+		}
+		defer workbook.Close()
+
+		for _, sheet := range workbook.GetSheetList() {
+			if err := xlsxSheetRows(workbook, sheet, info, yield); err != nil {
+				if err != errStopped {
+					yield(ParsedRow{}, err)
+				}
+				return
+			}
+		}
+	}
+}
+
+// errStopped is returned by xlsxSheetRows when the consumer stopped iterating.
+var errStopped = errors.New("stopped")
+
+// xlsxSheetRows yields the transaction rows of a single sheet.
+func xlsxSheetRows(workbook *excelize.File, sheet string, info *StatementInfo, yield func(ParsedRow, error) bool) error {
+	rows, err := workbook.Rows(sheet)
+	if err != nil {
+		return fmt.Errorf("failed to read sheet %s: %s", sheet, err.Error())
+	}
+	defer rows.Close()
+
+	var columns []int
+	for i := 1; rows.Next(); i++ {
+		// raw values keep dates as serial numbers regardless of how the cells are formatted
+		row, err := rows.Columns(excelize.Options{RawCellValue: true})
+		if err != nil {
+			return fmt.Errorf("failed to read row %d of sheet %s: %s", i, sheet, err.Error())
+		}
+
+		if columns == nil {
+			columns = xlsxHeaderColumns(row)
+			if columns == nil {
+				info.parseHeaderLine(strings.Join(row, " "))
+			}
+			continue
+		}
+
+		cells := make([]string, columnCount)
+		for col, index := range columns {
+			if index < len(row) {
+				cells[col] = strings.TrimSpace(row[index])
+			}
+		}
+
+		// skip blank rows and the totals at the bottom of the table, every other row is a transaction
+		// and is rejected if it's missing something
+		if xlsxBlankRow(cells) || xlsxTotalsRow(cells) {
+			continue
+		}
+
+		t, err := buildTransaction(
+			xlsxDateTime(cells[colDateTime]),
+			cells[colMoneyIn],
+			cells[colMoneyOut],
+			cells[colCategory],
+			cells[colParty],
+			cells[colDescription],
+			cells[colBalance],
+		)
+		var parsed ParsedRow
+		if err != nil {
+			parsed = rejectedRow(i, strings.Join(row, "\t"), err)
+		} else {
+			parsed = transactionRow(t, i)
+		}
+		if !yield(parsed, nil) {
+			return errStopped
+		}
+	}
+	return rows.Error()
+}
+
+// xlsxBlankRow reports whether every statement cell of the row is empty.
+func xlsxBlankRow(cells []string) bool {
+	for _, cell := range cells {
+		if cell != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// xlsxTotalsRow reports whether the row is the totals row at the bottom of the table, labelled in its
+// date column.
+func xlsxTotalsRow(cells []string) bool {
+	return strings.HasPrefix(strings.ToLower(cells[colDateTime]), "total")
+}
+
+// xlsxHeaderColumns returns the index of each statement column if the row is the transaction table header,
+// and nil otherwise.
+func xlsxHeaderColumns(row []string) []int {
+	columns := make([]int, columnCount)
+	for col, name := range statementColumns {
+		columns[col] = -1
+		for i, cell := range row {
+			if normalizeHeader(cell) == normalizeHeader(name) {
+				columns[col] = i
+				break
+			}
+		}
+		if columns[col] == -1 {
+			return nil
+		}
+	}
+	return columns
+}
+
+// xlsxDateTime converts a date stored as an Excel serial number into the layout used by the text statements.
+// Dates that are already formatted are returned unchanged.
+func xlsxDateTime(s string) string {
+	serial, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return s
+	}
+
+	t, err := excelize.ExcelDateToTime(serial, false)
+	if err != nil {
+		return s
+	}
+	return t.Format(statementTimeLayout)
+}
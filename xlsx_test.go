@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestXLSXDateTime(t *testing.T) {
+	tests := []struct {
+		name string
+		cell string
+		want string
+	}{
+		{name: "serial date", cell: "45292", want: "01/01/24 00:00:00"},
+		{name: "serial date and time", cell: "45292.5", want: "01/01/24 12:00:00"},
+		{name: "already formatted", cell: "12/03/24 14:05:11", want: "12/03/24 14:05:11"},
+		{name: "negative serial", cell: "-1", want: "-1"},
+		{name: "empty", cell: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := xlsxDateTime(tt.cell); got != tt.want {
+				t.Errorf("xlsxDateTime(%q) = %q, want %q", tt.cell, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestXLSXHeaderColumns(t *testing.T) {
+	tests := []struct {
+		name string
+		row  []string
+		want []int
+	}{
+		{name: "in order", row: statementColumns, want: []int{0, 1, 2, 3, 4, 5, 6}},
+		{
+			name: "reordered with spacing and case changes",
+			row:  []string{"", "Balance", "DATE/TIME", "To/From", "Money In", "Money Out", "Category", "Description"},
+			want: []int{2, 4, 5, 6, 3, 7, 1},
+		},
+		{name: "a column missing", row: []string{"Date/Time", "Money In", "Money Out", "Category", "Description", "Balance"}},
+		{name: "preamble", row: []string{"Account Number", "2012345678"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := xlsxHeaderColumns(tt.row)
+			if len(got) != len(tt.want) {
+				t.Fatalf("xlsxHeaderColumns() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("xlsxHeaderColumns() column %d = %d, want %d", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseXLSX(t *testing.T) {
+	workbook := excelize.NewFile()
+	sheet := workbook.GetSheetName(0)
+	rows := [][]any{
+		{"Account Number", "2012345678"},
+		{"Date/Time", "Money In", "Money Out", "Category", "To / From", "Description", "Balance"},
+		{45292.5, "₦15,000.00", "", "Inward Transfer", "JOHN DOE", "Rent", "₦27,450.00"},
+		{},
+		{"02/01/24 08:00:00", "", "₦2,500.00", "Outward Transfer", "Mama Put Kitchen", "lunch", "₦24,950.00"},
+		{"03/01/24 09:00:00", "", "", "Outward Transfer", "Mama Put Kitchen", "lunch", "₦24,950.00"},
+		{"", "", "", "", "", "", ""},
+		{"Total", "₦15,000.00", "₦2,500.00", "", "", "", ""},
+	}
+	for i, row := range rows {
+		cell, _ := excelize.CoordinatesToCellName(1, i+1)
+		if err := workbook.SetSheetRow(sheet, cell, &row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var buf bytes.Buffer
+	if err := workbook.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	info := &StatementInfo{}
+	var parsed []ParsedRow
+	for row, err := range parseXLSX(&buf, int64(buf.Len()), info) {
+		if err != nil {
+			t.Fatalf("parseXLSX() error = %v", err)
+		}
+		parsed = append(parsed, row)
+	}
+
+	if info.AccountNumber != "2012345678" {
+		t.Errorf("account number = %q, want 2012345678", info.AccountNumber)
+	}
+	if len(parsed) != 3 {
+		t.Fatalf("parseXLSX() = %d rows, want 3", len(parsed))
+	}
+	// a row without an amount is reported, not dropped
+	if rejected := parsed[2].Rejected; rejected == nil || !errors.Is(rejected.Err, ErrMissingAmount) || rejected.Line != 6 {
+		t.Errorf("row without an amount = %+v, want it rejected on line 6 with %v", parsed[2], ErrMissingAmount)
+	}
+	for i, want := range []string{"01/01/24 12:00:00", "02/01/24 08:00:00"} {
+		if parsed[i].Transaction == nil {
+			t.Fatalf("row %d rejected: %+v", i, parsed[i])
+		}
+		if got := parsed[i].Transaction.DateTime.Format(statementTimeLayout); got != want {
+			t.Errorf("row %d time = %s, want %s", i, got, want)
+		}
+	}
+}